@@ -0,0 +1,464 @@
+// Package builder renders markdown documents with embedded PlantUML diagrams,
+// which is what the markr command does, for using it from other programs.
+package builder
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"go.uber.org/zap"
+
+	"github.com/lalloni/markr/converters"
+	"github.com/lalloni/markr/fileutils"
+	"github.com/lalloni/markr/logging"
+	"github.com/lalloni/markr/options"
+	"github.com/lalloni/markr/pandoc"
+	"github.com/lalloni/markr/plantuml"
+	"github.com/lalloni/markr/sourcemap"
+)
+
+// Config tells how to build a document.
+type Config struct {
+	// InputName names the input in diagnostics and diagram file names, it is
+	// usually the input file path.
+	InputName string
+	// Format is the output format: "pdf", "latex", "html", "epub", "docx" or
+	// "odt".
+	Format string
+	// Settings left empty where that means nothing (DiagramsDPI, PDFEngine
+	// and Converter) take their DefaultConfig values, the others are used as
+	// given, so configurations should start from DefaultConfig.
+	options.Settings
+	// Logger receives the build log, nothing is logged when nil.
+	Logger *zap.Logger
+}
+
+// DefaultConfig returns the configuration used by markr when no flags are
+// given, for the output format.
+func DefaultConfig(format string) Config {
+	return Config{
+		Format: format,
+		Settings: options.Settings{
+			DiagramsDPI:      300,
+			PDFEngine:        "xelatex",
+			Converter:        converters.Auto,
+			PDFNative:        true,
+			PlantUMLTimeout:  time.Minute,
+			ConverterTimeout: time.Minute,
+			PandocTimeout:    5 * time.Minute,
+		},
+	}
+}
+
+// Result describes a build.
+type Result struct {
+	// Dependencies are the files the output depends on.
+	Dependencies []string
+	// Diagrams is the number of diagrams rendered.
+	Diagrams int
+	// CacheHits is the number of diagrams taken from the cache.
+	CacheHits int
+	// Warnings are problems which didn't stop the build.
+	Warnings []string
+}
+
+// options returns the options the tool packages read.
+func (c Config) options() *options.Options {
+	return &options.Options{Settings: c.Settings, InputFile: c.InputName}
+}
+
+// diagramsCache returns the directory where diagrams are cached.
+func diagramsCache() (string, error) {
+	dir, err := homedir.Expand("~/.cache/markr/diagrams")
+	if err != nil {
+		return "", fmt.Errorf("building diagrams cache location: %v", err)
+	}
+	return dir, nil
+}
+
+// DiagramFile returns the file the diagram with the source checksum id is
+// cached in the format.
+func DiagramFile(id, format string) (string, error) {
+	dir, err := diagramsCache()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, id+"."+format), nil
+}
+
+// Build renders the markdown read from input to output as configured. Failures
+// are returned as *Error.
+func Build(ctx context.Context, config Config, input io.Reader, output io.Writer) (Result, error) {
+	logger := config.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if config.InputName == "" {
+		config.InputName = "<input>"
+	}
+	defaults := DefaultConfig(config.Format)
+	if config.DiagramsDPI == 0 {
+		config.DiagramsDPI = defaults.DiagramsDPI
+	}
+	if config.PDFEngine == "" {
+		config.PDFEngine = defaults.PDFEngine
+	}
+	if config.Converter == "" {
+		config.Converter = defaults.Converter
+	}
+	ctx = logging.WithZapLogger(ctx, logger)
+	ctx = options.WithOptions(ctx, config.options())
+	ctx, err := fileutils.WithWorkspace(ctx, config.KeepTemp)
+	if err != nil {
+		return Result{Dependencies: []string{config.InputName}}, NewError(Failure, "preparing build", err)
+	}
+	defer fileutils.Cleanup(ctx)
+	return build(ctx, config.Format, input, output)
+}
+
+func build(ctx context.Context, format string, input io.Reader, output io.Writer) (Result, error) {
+	log := logging.ZapLogger(ctx).Sugar()
+	opts := options.Get(ctx)
+	result := Result{Dependencies: []string{opts.InputFile}}
+
+	target, err := pandoc.LookupTarget(format)
+	if err != nil {
+		return result, NewError(Usage, "checking output format", err)
+	}
+
+	if target.Links && opts.DiagramsDir == "" {
+		return result, NewError(Usage, "checking output format", fmt.Errorf("%s output links diagrams, a diagrams directory is needed", target.Name))
+	}
+
+	var engine pandoc.Engine
+	if target.Name == "pdf" {
+		engine, err = pandoc.CheckEngine(ctx, opts.PDFEngine)
+		if err != nil {
+			return result, NewError(Usage, "checking PDF engine", err)
+		}
+	}
+
+	if opts.Diagrams == "" {
+		opts.Diagrams = pandoc.ImageFormats(target, engine)[0]
+		log.Infow("selected diagrams format", "format", opts.Diagrams, "target", target.Name)
+	} else if !isDiagramFormat(opts.Diagrams) {
+		return result, NewError(Usage, "checking diagrams format", fmt.Errorf("unknown diagram format: %q", opts.Diagrams))
+	} else {
+		err = pandoc.CheckImageFormat(target, engine, opts.Diagrams)
+		if err != nil {
+			log.Warnw("diagrams format is a poor fit for the output", "warning", err)
+			result.Warnings = append(result.Warnings, err.Error())
+		}
+	}
+
+	if opts.Cache {
+		dir, err := diagramsCache()
+		if err == nil {
+			err = os.MkdirAll(dir, 0700)
+		}
+		if err != nil {
+			return result, NewError(Failure, "preparing diagrams cache", err)
+		}
+	}
+
+	r := &renderer{result: &result}
+	r.style.theme = opts.PlantUMLTheme
+	r.style.config = opts.PlantUMLConfig
+	if opts.PlantUMLConfig != "" {
+		if _, err := os.Stat(opts.PlantUMLConfig); err != nil {
+			kind := Failure
+			if os.IsNotExist(err) {
+				kind = InputNotFound
+			}
+			return result, NewError(kind, "preparing diagrams", fmt.Errorf("checking plantuml config: %v", err))
+		}
+		result.Dependencies = append(result.Dependencies, opts.PlantUMLConfig)
+	}
+	r.style.preamble, err = loadPreamble(opts.PlantUMLPreamble)
+	if err != nil {
+		kind := Failure
+		if errors.Is(err, os.ErrNotExist) {
+			kind = InputNotFound
+		}
+		return result, NewError(kind, "preparing diagrams", err)
+	}
+	if opts.PlantUMLPreamble != "" {
+		result.Dependencies = append(result.Dependencies, opts.PlantUMLPreamble)
+	}
+	d := &document{renderer: r, result: &result}
+	err = d.read(ctx, opts.InputFile, input, 0, nil)
+	if err != nil {
+		return result, err
+	}
+	markdown, sources := &d.markdown, &d.sources
+
+	document := fileutils.TempFileName(ctx, "output", "document", strings.TrimPrefix(target.Extensions[0], "."))
+	lines := strings.Split(markdown.String(), "\n")
+	err = pandoc.RenderMarkdown(ctx, markdown, document)
+	if err != nil {
+		diagnostics := latexDiagnostics(err, lines, sources, opts.InputFile)
+		if len(diagnostics) == 0 {
+			diagnostics = toolOutput(err)
+		}
+		return result, NewError(Pandoc, "rendering markdown", err, append(r.details, diagnostics...)...)
+	}
+
+	rendered, err := os.Open(document)
+	if err != nil {
+		return result, NewError(Failure, "opening rendered document", err)
+	}
+	defer rendered.Close()
+	_, err = io.Copy(output, rendered)
+	if err != nil {
+		return result, NewError(Failure, "writing to output", err)
+	}
+
+	if len(r.failures) > 0 {
+		details := append(r.details, fmt.Sprintf("%d diagram(s) failed and were replaced by placeholders:", len(r.failures)))
+		for _, f := range r.failures {
+			details = append(details, "    "+f)
+		}
+		return result, NewError(Diagram, "generating diagrams", fmt.Errorf("%d diagram(s) failed", len(r.failures)), details...)
+	}
+
+	return result, nil
+}
+
+// document assembles the markdown of a build from its input and the files
+// it includes.
+type document struct {
+	markdown bytes.Buffer
+	// sources are the locations of the markdown lines.
+	sources  sourcemap.Map
+	renderer *renderer
+	result   *Result
+}
+
+// read appends the markdown of input, which is the file included through
+// the files in including, shifting its headings by shift levels.
+func (d *document) read(ctx context.Context, file string, input io.Reader, shift int, including []string) error {
+	log := logging.ZapLogger(ctx).Sugar()
+	var m *macro
+	var fence string
+	var lines []string
+	ins := bufio.NewScanner(bufio.NewReader(input))
+	for ins.Scan() {
+		lines = append(lines, ins.Text())
+	}
+	if ins.Err() != nil {
+		return NewError(Failure, "reading input", ins.Err())
+	}
+	start := 0
+	if including == nil {
+		if settings, n, ok := frontMatter(lines); ok {
+			err := d.configure(ctx, file, settings)
+			if err != nil {
+				return err
+			}
+			for i, line := range lines[:n] {
+				d.copy(file, i+1, line)
+			}
+			start = n
+		}
+	}
+	for i := start; i < len(lines); i++ {
+		line, lineno := lines[i], i+1
+		log.Infow("read", "file", file, "line", line)
+		if ctx.Err() != nil {
+			return NewError(Failure, "reading input", ctx.Err())
+		}
+
+		closed := false
+		if m == nil {
+			var ok bool
+			switch {
+			case fence != "":
+				if closesFence(fence, line) {
+					fence = ""
+				}
+				d.copy(file, lineno, line)
+				continue
+			case isMacroStart(line):
+				log.Info("starting plantuml macro")
+				m, closed = parseMacro(file, line, lineno)
+			case isInclude(line):
+				err := d.include(ctx, file, lineno, line, shift, including)
+				if err != nil {
+					return err
+				}
+				continue
+			default:
+				if m, ok = parseFence(file, line, lineno); ok {
+					log.Info("starting fenced plantuml macro")
+					break
+				}
+				if fence = openingFence(line); fence == "" {
+					line = shiftHeading(line, shift)
+					if including != nil {
+						line = relinkImages(line, file)
+					}
+				}
+				d.result.Dependencies = append(d.result.Dependencies, images(line)...)
+				d.copy(file, lineno, line)
+				continue
+			}
+			if m.file != "" {
+				d.result.Dependencies = append(d.result.Dependencies, m.file)
+			}
+			if m.config != "" {
+				d.result.Dependencies = append(d.result.Dependencies, m.config)
+			}
+		} else if m.closes(line) {
+			closed = true
+			m.end = lineno
+		} else {
+			log.Info("keeping plantuml line")
+			m.body = append(m.body, line)
+		}
+
+		if !closed {
+			continue
+		}
+
+		log.Info("macro end")
+		var md string
+		st := m.style(d.renderer.style)
+		source, umlSources, err := m.source(file, st)
+		if err != nil {
+			md, err = d.renderer.failed(ctx, fmt.Sprintf("%s:%d: %v", file, m.line, err), err, nil)
+		} else {
+			md, err = d.renderer.render(ctx, source, umlSources, st)
+		}
+		if err != nil {
+			return err
+		}
+		d.markdown.WriteString(md)
+		for i := 0; i < strings.Count(md, "\n"); i++ {
+			d.sources.Add(file, m.line)
+		}
+		m = nil
+	}
+	return nil
+}
+
+// copy appends the markdown line, which is at lineno of file.
+func (d *document) copy(file string, lineno int, line string) {
+	d.markdown.WriteString(line + "\n")
+	d.sources.Add(file, lineno)
+}
+
+// renderer renders the diagrams of a build.
+type renderer struct {
+	// native tells whether plantuml renders PDF diagrams by itself and
+	// converter converts them from SVG otherwise, which are decided for the
+	// first PDF diagram rendered.
+	native    bool
+	converter converters.Converter
+	// style is the style of the diagrams unless their macros override it.
+	style  style
+	result *Result
+	// failures are the summaries of the diagrams which failed when keeping
+	// going, and details their diagnostics.
+	failures []string
+	details  []string
+}
+
+// render renders the diagram source with the style, whose lines come from
+// the locations in sources, and returns the markdown embedding it.
+func (r *renderer) render(ctx context.Context, source string, sources *sourcemap.Map, st style) (string, error) {
+	log := logging.ZapLogger(ctx).Sugar()
+	opts := options.Get(ctx)
+
+	sha1hex, args, err := st.key(source, opts.Diagrams, opts.DiagramsDPI)
+	if err != nil {
+		location := "diagram"
+		if l, ok := sources.Lookup(1); ok {
+			location = l.String()
+		}
+		return r.failed(ctx, fmt.Sprintf("%s: %v", location, err), err, nil)
+	}
+	log.Infow("uml source checksum", "sha1", sha1hex)
+
+	diagram := fileutils.TempFileName(ctx, "diagram", sha1hex, opts.Diagrams)
+	if opts.Cache {
+		diagram, err = DiagramFile(sha1hex, opts.Diagrams)
+		if err != nil {
+			return "", NewError(Failure, "locating cached diagram", err)
+		}
+	}
+
+	if _, err := os.Stat(diagram); opts.Cache && err == nil {
+		r.result.CacheHits++
+	} else {
+		r.result.Diagrams++
+		uml := strings.NewReader(source)
+		if opts.Diagrams == "pdf" && !r.native && r.converter == nil {
+			if opts.PDFNative && plantuml.SupportsPDF(ctx) {
+				log.Info("using plantuml native PDF rendering")
+				r.native = true
+			} else {
+				r.converter, err = converters.Select(opts.Converter)
+				if err != nil {
+					return "", NewError(Usage, "selecting SVG to PDF converter", err)
+				}
+				log.Infow("using SVG to PDF converter", "converter", r.converter.Name())
+			}
+		}
+		switch opts.Diagrams {
+		case "pdf":
+			err = generatePDF(ctx, uml, diagram, r.converter, args...)
+		case "eps":
+			err = generateEPS(ctx, uml, diagram, args...)
+		case "svg":
+			err = generateSVG(ctx, uml, diagram, args...)
+		case "png":
+			err = generatePNG(ctx, uml, diagram, args...)
+		default:
+			err = fmt.Errorf("unknown diagram format: %q", opts.Diagrams)
+		}
+		if err != nil {
+			log.Infow("generating diagram", "error", err, "source", source)
+			summary, details := diagramDiagnostics(err, source, sources)
+			return r.failed(ctx, summary, err, details)
+		}
+		if opts.Cache {
+			log.Infow("keeping for cache", "file", diagram)
+		}
+	}
+
+	if opts.DiagramsDir != "" {
+		file := filepath.Join(opts.DiagramsDir, sha1hex+"."+opts.Diagrams)
+		err = fileutils.Copy(diagram, file)
+		if err != nil {
+			return "", NewError(Failure, "writing diagram", err)
+		}
+		diagram = file
+	}
+
+	log.Infow("using diagram", "file", diagram)
+	link := diagram
+	if opts.DiagramsURL != "" {
+		link = opts.DiagramsURL + sha1hex + "." + opts.Diagrams
+	}
+	return fmt.Sprintf("![](%s)\n", link), nil
+}
+
+// failed returns the placeholder markdown for a diagram which failed when
+// keeping going, or else the build error caused by err.
+func (r *renderer) failed(ctx context.Context, summary string, err error, details []string) (string, error) {
+	if !options.Get(ctx).KeepGoing {
+		return "", NewError(Diagram, "generating diagram", &summarized{summary: summary, err: err}, details...)
+	}
+	r.failures = append(r.failures, summary)
+	r.details = append(r.details, details...)
+	return placeholder(summary), nil
+}
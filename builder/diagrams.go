@@ -0,0 +1,121 @@
+package builder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lalloni/markr/converters"
+	"github.com/lalloni/markr/fileutils"
+	"github.com/lalloni/markr/options"
+	"github.com/lalloni/markr/plantuml"
+)
+
+var diagramFormats = []string{"pdf", "eps", "svg", "png"}
+
+func isDiagramFormat(format string) bool {
+	for _, f := range diagramFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+func generatePDF(ctx context.Context, uml io.Reader, diagram string, converter converters.Converter, args ...string) error {
+	if converter == nil {
+		return generateNativePDF(ctx, uml, diagram, args...)
+	}
+	var svg bytes.Buffer
+	err := plantuml.Render(ctx, uml, &svg, "svg", args...)
+	if err != nil {
+		return fmt.Errorf("rendering with plantuml: %w", err)
+	}
+	var pdf bytes.Buffer
+	err = converter.ConvertToPDF(ctx, &svg, &pdf)
+	if err != nil {
+		return fmt.Errorf("converting with %s: %w", converter.Name(), err)
+	}
+	err = fileutils.WriteFile(diagram, pdf.Bytes(), 0600)
+	if err != nil {
+		return fmt.Errorf("writing PDF file: %v", err)
+	}
+	return nil
+}
+
+func generateNativePDF(ctx context.Context, uml io.Reader, diagram string, args ...string) error {
+	var pdf bytes.Buffer
+	err := plantuml.Render(ctx, uml, &pdf, "pdf", args...)
+	if err != nil {
+		return fmt.Errorf("rendering with plantuml: %w", err)
+	}
+	err = fileutils.WriteFile(diagram, pdf.Bytes(), 0600)
+	if err != nil {
+		return fmt.Errorf("writing PDF file: %v", err)
+	}
+	return nil
+}
+
+func generateEPS(ctx context.Context, uml io.Reader, diagram string, args ...string) error {
+	return generateDirect(ctx, uml, diagram, "eps", args...)
+}
+
+func generateSVG(ctx context.Context, uml io.Reader, diagram string, args ...string) error {
+	return generateDirect(ctx, uml, diagram, "svg", args...)
+}
+
+func generatePNG(ctx context.Context, uml io.Reader, diagram string, args ...string) error {
+	dpi := options.Get(ctx).DiagramsDPI
+	return generateDirect(ctx, uml, diagram, "png", append(args, "-Sdpi="+strconv.Itoa(dpi))...)
+}
+
+// generateDirect writes the diagram in a format plantuml renders by itself.
+func generateDirect(ctx context.Context, uml io.Reader, diagram, format string, args ...string) error {
+	var out bytes.Buffer
+	err := plantuml.Render(ctx, uml, &out, format, args...)
+	if err != nil {
+		return fmt.Errorf("rendering with plantuml: %w", err)
+	}
+	err = fileutils.WriteFile(diagram, out.Bytes(), 0600)
+	if err != nil {
+		return fmt.Errorf("writing %s file: %v", strings.ToUpper(format), err)
+	}
+	return nil
+}
+
+var imagePattern = regexp.MustCompile(`!\[[^\]]*\]\(<?([^)\s>]+)`)
+
+// images returns the local image files referenced in the markdown line.
+func images(line string) []string {
+	var files []string
+	for _, m := range imagePattern.FindAllStringSubmatch(line, -1) {
+		if !strings.Contains(m[1], "://") {
+			files = append(files, m[1])
+		}
+	}
+	return files
+}
+
+// relinkImages returns the markdown line with the relative paths of its local
+// images, which are relative to the directory of file, made relative to the
+// working directory like the file.
+func relinkImages(line, file string) string {
+	return imagePattern.ReplaceAllStringFunc(line, func(s string) string {
+		p := imagePattern.FindStringSubmatch(s)[1]
+		if strings.Contains(p, "://") || filepath.IsAbs(p) {
+			return s
+		}
+		return s[:len(s)-len(p)] + filepath.ToSlash(relative(file, p))
+	})
+}
+
+// placeholder returns the markdown for a visible replacement of a diagram
+// which failed.
+func placeholder(failure string) string {
+	return fmt.Sprintf("\n> **Diagram error:** `%s`\n\n", strings.Replace(failure, "`", "'", -1))
+}
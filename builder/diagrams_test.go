@@ -0,0 +1,43 @@
+package builder
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestImages(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{line: "![a figure](fig.png)", want: []string{"fig.png"}},
+		{line: `![](img/a.png "title") and ![b](<b.svg>)`, want: []string{"img/a.png", "b.svg"}},
+		{line: "![remote](https://example.com/a.png)"},
+		{line: "[a link](doc.md)"},
+		{line: "text"},
+	}
+	for _, tt := range tests {
+		if got := images(tt.line); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("images(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestRelinkImages(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{line: "![a figure](fig.png)", want: "![a figure](chapters/fig.png)"},
+		{line: `![](img/a.png "title")`, want: `![](chapters/img/a.png "title")`},
+		{line: "![](../a.png) ![](b.png)", want: "![](a.png) ![](chapters/b.png)"},
+		{line: "![remote](https://example.com/a.png)", want: "![remote](https://example.com/a.png)"},
+		{line: "![absolute](/srv/a.png)", want: "![absolute](/srv/a.png)"},
+		{line: "[a link](doc.md)", want: "[a link](doc.md)"},
+	}
+	for _, tt := range tests {
+		if got := relinkImages(tt.line, "chapters/intro.md"); got != tt.want {
+			t.Errorf("relinkImages(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/lalloni/markr/latex"
+	"github.com/lalloni/markr/plantuml"
+	"github.com/lalloni/markr/processes"
+	"github.com/lalloni/markr/sourcemap"
+)
+
+// Kind classifies build failures.
+type Kind int
+
+const (
+	// Failure is any failure not classified otherwise.
+	Failure Kind = iota
+	// Usage is an invalid configuration.
+	Usage
+	// InputNotFound is a missing input file.
+	InputNotFound
+	// Diagram is a failure rendering diagrams.
+	Diagram
+	// Pandoc is a failure rendering the document.
+	Pandoc
+	// ToolMissing is an external tool not installed.
+	ToolMissing
+)
+
+// Error is a build failure along with its kind and the diagnostics
+// explaining it.
+type Error struct {
+	Kind    Kind
+	Stage   string
+	Err     error
+	Details []string
+}
+
+func (e *Error) Error() string {
+	return e.Stage + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Text returns the diagnostics followed by the one line summary.
+func (e *Error) Text() string {
+	var b strings.Builder
+	for _, d := range e.Details {
+		fmt.Fprintln(&b, d)
+	}
+	fmt.Fprintf(&b, "markr: %v\n", e)
+	return b.String()
+}
+
+// NewError returns a build error of the kind for the stage, unless it is due
+// to a missing tool.
+func NewError(kind Kind, stage string, err error, details ...string) *Error {
+	if errors.Is(err, exec.ErrNotFound) {
+		kind = ToolMissing
+	}
+	return &Error{Kind: kind, Stage: stage, Err: err, Details: details}
+}
+
+// summarized is an error shown as its summary which keeps the error causing
+// it.
+type summarized struct {
+	summary string
+	err     error
+}
+
+func (s *summarized) Error() string {
+	return s.summary
+}
+
+func (s *summarized) Unwrap() error {
+	return s.err
+}
+
+// toolOutput returns what the external tool causing err, if any, wrote to its
+// standard error.
+func toolOutput(err error) []string {
+	var terr *processes.ExternalToolError
+	if !errors.As(err, &terr) {
+		return nil
+	}
+	lines := terr.StderrLines()
+	if len(lines) == 0 {
+		return nil
+	}
+	details := []string{terr.Tool + " error output:"}
+	for _, l := range lines {
+		details = append(details, "    "+l)
+	}
+	return details
+}
+
+// diagramDiagnostics returns a one line description of the diagram error
+// prefixed by its location and the details explaining it, which for plantuml
+// syntax errors are a compiler-style diagnostic at the markdown source line
+// it comes from.
+func diagramDiagnostics(err error, uml string, sources *sourcemap.Map) (string, []string) {
+	location := "diagram"
+	if l, ok := sources.Lookup(1); ok {
+		location = l.String()
+	}
+	var terr *processes.ExternalToolError
+	if !errors.As(err, &terr) {
+		return fmt.Sprintf("%s: %v", location, err), nil
+	}
+	e, ok := plantuml.ParseSyntaxError(terr.Stderr)
+	if !ok {
+		return fmt.Sprintf("%s: %v", location, err), toolOutput(err)
+	}
+	if l, ok := sources.Lookup(e.Line + 1); ok {
+		location = l.String()
+	}
+	details := []string{fmt.Sprintf("%s: error: %s", location, e.Message)}
+	lines := strings.Split(uml, "\n")
+	if e.Line < len(lines) {
+		line := lines[e.Line]
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		details = append(details, "    "+line, "    "+indent+"^")
+	}
+	return fmt.Sprintf("%s: %s", location, e.Message), details
+}
+
+// latexDiagnostics returns the LaTeX errors reported by the tool causing err,
+// if any, at the markdown source lines they come from.
+func latexDiagnostics(err error, lines []string, sources *sourcemap.Map, file string) []string {
+	var terr *processes.ExternalToolError
+	if !errors.As(err, &terr) {
+		return nil
+	}
+	var details []string
+	for _, e := range latex.Parse(terr.Stderr) {
+		location := file
+		if i := latex.Locate(e, lines); i >= 0 {
+			if l, ok := sources.Lookup(i + 1); ok {
+				location = l.String()
+			}
+		}
+		details = append(details, fmt.Sprintf("%s: %s", location, e))
+	}
+	return details
+}
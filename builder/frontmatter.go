@@ -0,0 +1,86 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// frontMatterKeys are the keys of the document YAML front matter markr reads.
+var frontMatterKeys = []string{"plantuml-preamble", "plantuml-theme", "plantuml-config"}
+
+func isFrontMatterStart(line string) bool {
+	return line == "---"
+}
+
+func isFrontMatterEnd(line string) bool {
+	return line == "---" || line == "..."
+}
+
+// frontMatter returns the settings of the front matter starting the lines, if
+// any, and the number of lines it spans. As in pandoc, the opening line can't
+// be followed by a blank one and the block must be closed.
+func frontMatter(lines []string) (map[string]string, int, bool) {
+	if len(lines) < 2 || !isFrontMatterStart(lines[0]) || strings.TrimSpace(lines[1]) == "" {
+		return nil, 0, false
+	}
+	settings := map[string]string{}
+	for i, line := range lines[1:] {
+		if isFrontMatterEnd(line) {
+			return settings, i + 2, true
+		}
+		if k, v, ok := frontMatterSetting(line); ok {
+			settings[k] = v
+		}
+	}
+	return nil, 0, false
+}
+
+// frontMatterSetting returns the key and value of the front matter line when
+// it is a top level "key: value" pair markr reads.
+func frontMatterSetting(line string) (string, string, bool) {
+	i := strings.Index(line, ":")
+	if i <= 0 || !contains(frontMatterKeys, line[:i]) {
+		return "", "", false
+	}
+	value := strings.TrimSpace(line[i+1:])
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	}
+	return line[:i], value, true
+}
+
+// configure applies the settings of the front matter of file, which override
+// the build options.
+func (d *document) configure(ctx context.Context, file string, settings map[string]string) error {
+	if p, ok := settings["plantuml-preamble"]; ok {
+		if p != "" {
+			p = relative(file, p)
+		}
+		pre, err := loadPreamble(p)
+		if err != nil {
+			kind := Failure
+			if errors.Is(err, os.ErrNotExist) {
+				kind = InputNotFound
+			}
+			return NewError(kind, "reading front matter", fmt.Errorf("%s: %v", file, err))
+		}
+		d.renderer.style.preamble = pre
+		if p != "" {
+			d.result.Dependencies = append(d.result.Dependencies, p)
+		}
+	}
+	if t, ok := settings["plantuml-theme"]; ok {
+		d.renderer.style.theme = t
+	}
+	if c, ok := settings["plantuml-config"]; ok {
+		if c != "" {
+			c = relative(file, c)
+			d.result.Dependencies = append(d.result.Dependencies, c)
+		}
+		d.renderer.style.config = c
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package builder
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFrontMatter(t *testing.T) {
+	tests := []struct {
+		name     string
+		lines    []string
+		settings map[string]string
+		n        int
+		ok       bool
+	}{
+		{
+			name:     "closed with dashes",
+			lines:    []string{"---", "title: Doc", "plantuml-theme: cerulean", "---", "# Doc"},
+			settings: map[string]string{"plantuml-theme": "cerulean"},
+			n:        4,
+			ok:       true,
+		},
+		{
+			name:     "closed with dots",
+			lines:    []string{"---", "plantuml-config: 'a.cfg'", "...", "text"},
+			settings: map[string]string{"plantuml-config": "a.cfg"},
+			n:        3,
+			ok:       true,
+		},
+		{
+			name:     "without markr settings",
+			lines:    []string{"---", "title: Doc", "---"},
+			settings: map[string]string{},
+			n:        3,
+			ok:       true,
+		},
+		{name: "followed by a blank line", lines: []string{"---", "", "plantuml-theme: x", "---"}},
+		{name: "followed by a space only line", lines: []string{"---", "  ", "---"}},
+		{name: "not closed", lines: []string{"---", "plantuml-theme: x", "# Doc"}},
+		{name: "not at the start", lines: []string{"# Doc", "---", "plantuml-theme: x", "---"}},
+		{name: "only dashes", lines: []string{"---"}},
+		{name: "empty", lines: nil},
+	}
+	for _, tt := range tests {
+		settings, n, ok := frontMatter(tt.lines)
+		if ok != tt.ok || n != tt.n || !reflect.DeepEqual(settings, tt.settings) {
+			t.Errorf("%s: frontMatter() = %v, %d, %v, want %v, %d, %v", tt.name, settings, n, ok, tt.settings, tt.n, tt.ok)
+		}
+	}
+}
+
+func TestFrontMatterSetting(t *testing.T) {
+	tests := []struct {
+		line       string
+		key, value string
+		ok         bool
+	}{
+		{line: "plantuml-theme: cerulean", key: "plantuml-theme", value: "cerulean", ok: true},
+		{line: `plantuml-preamble: "style/common.puml"`, key: "plantuml-preamble", value: "style/common.puml", ok: true},
+		{line: "plantuml-config: 'a b.cfg'", key: "plantuml-config", value: "a b.cfg", ok: true},
+		{line: "plantuml-theme:", key: "plantuml-theme", value: "", ok: true},
+		{line: `plantuml-theme: "unbalanced'`, key: "plantuml-theme", value: `"unbalanced'`, ok: true},
+		{line: "title: Doc"},
+		{line: "  plantuml-theme: nested"},
+		{line: "plantuml-theme"},
+	}
+	for _, tt := range tests {
+		key, value, ok := frontMatterSetting(tt.line)
+		if key != tt.key || value != tt.value || ok != tt.ok {
+			t.Errorf("frontMatterSetting(%q) = %q, %q, %v, want %q, %q, %v", tt.line, key, value, ok, tt.key, tt.value, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const IncludeDelimiter = "{{include"
+
+// includeAttributes are the attributes an include accepts.
+var includeAttributes = []string{"shift"}
+
+var headingPattern = regexp.MustCompile(`^(#{1,6})(\s|$)`)
+
+func isInclude(line string) bool {
+	return strings.HasPrefix(line, IncludeDelimiter+" ")
+}
+
+// parseInclude returns the path and attributes of the include line.
+func parseInclude(line string) (string, map[string]string, error) {
+	rest := strings.TrimSpace(strings.TrimPrefix(line, IncludeDelimiter))
+	if !strings.HasSuffix(rest, EndDelimiter) {
+		return "", nil, fmt.Errorf("include must end with %q on the same line", EndDelimiter)
+	}
+	rest = strings.TrimSpace(strings.TrimSuffix(rest, EndDelimiter))
+	var path string
+	if strings.HasPrefix(rest, `"`) {
+		i := strings.Index(rest[1:], `"`)
+		if i < 0 {
+			return "", nil, fmt.Errorf("unterminated quoted include path")
+		}
+		path, rest = rest[1:i+1], rest[i+2:]
+	} else {
+		i := strings.IndexAny(rest, " \t")
+		if i < 0 {
+			i = len(rest)
+		}
+		path, rest = rest[:i], rest[i:]
+	}
+	if path == "" {
+		return "", nil, fmt.Errorf("missing include path")
+	}
+	attrs, err := attributes(rest)
+	if err != nil {
+		return "", nil, err
+	}
+	for k := range attrs {
+		if !contains(includeAttributes, k) {
+			return "", nil, fmt.Errorf("unknown include attribute %q", k)
+		}
+	}
+	return path, attrs, nil
+}
+
+// include appends the markdown of the file included by the line, which is at
+// lineno of file.
+func (d *document) include(ctx context.Context, file string, lineno int, line string, shift int, including []string) error {
+	path, attrs, err := parseInclude(line)
+	if err != nil {
+		return NewError(Usage, "including file", fmt.Errorf("%s:%d: %v", file, lineno, err))
+	}
+	if s, ok := attrs["shift"]; ok {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return NewError(Usage, "including file", fmt.Errorf("%s:%d: invalid shift %q", file, lineno, s))
+		}
+		shift += n
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(file), path)
+	}
+	including = append(including, file)
+	for _, f := range including {
+		if sameFile(f, path) {
+			return NewError(Usage, "including file", fmt.Errorf("%s:%d: include cycle: %s -> %s", file, lineno, strings.Join(including, " -> "), path))
+		}
+	}
+	d.result.Dependencies = append(d.result.Dependencies, path)
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return NewError(InputNotFound, "including file", fmt.Errorf("%s:%d: %v", file, lineno, err))
+		}
+		return NewError(Failure, "including file", fmt.Errorf("%s:%d: %v", file, lineno, err))
+	}
+	defer f.Close()
+	return d.read(ctx, path, f, shift, including)
+}
+
+// sameFile tells whether both paths name the same file.
+func sameFile(a, b string) bool {
+	aa, err := filepath.Abs(a)
+	if err != nil {
+		return a == b
+	}
+	ab, err := filepath.Abs(b)
+	if err != nil {
+		return a == b
+	}
+	return aa == ab
+}
+
+// shiftHeading returns the line with its heading level, if it is a heading,
+// shifted by shift levels (within 1 and 6).
+func shiftHeading(line string, shift int) string {
+	m := headingPattern.FindStringSubmatch(line)
+	if shift == 0 || m == nil {
+		return line
+	}
+	level := len(m[1]) + shift
+	if level < 1 {
+		level = 1
+	}
+	if level > 6 {
+		level = 6
+	}
+	return strings.Repeat("#", level) + line[len(m[1]):]
+}
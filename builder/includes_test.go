@@ -0,0 +1,59 @@
+package builder
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseInclude(t *testing.T) {
+	tests := []struct {
+		line    string
+		path    string
+		attrs   map[string]string
+		wantErr bool
+	}{
+		{line: "{{include chapters/intro.md}}", path: "chapters/intro.md", attrs: map[string]string{}},
+		{line: "{{include  chapters/intro.md  }}", path: "chapters/intro.md", attrs: map[string]string{}},
+		{line: "{{include chapters/intro.md shift=1}}", path: "chapters/intro.md", attrs: map[string]string{"shift": "1"}},
+		{line: `{{include "my chapter.md" shift=-1}}`, path: "my chapter.md", attrs: map[string]string{"shift": "-1"}},
+		{line: "{{include chapters/intro.md", wantErr: true},
+		{line: "{{include }}", wantErr: true},
+		{line: `{{include "unterminated}}`, wantErr: true},
+		{line: "{{include a.md level=2}}", wantErr: true},
+		{line: "{{include a.md shift}}", wantErr: true},
+	}
+	for _, tt := range tests {
+		path, attrs, err := parseInclude(tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseInclude(%q) error = %v, want error %v", tt.line, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (path != tt.path || !reflect.DeepEqual(attrs, tt.attrs)) {
+			t.Errorf("parseInclude(%q) = %q, %v, want %q, %v", tt.line, path, attrs, tt.path, tt.attrs)
+		}
+	}
+}
+
+func TestShiftHeading(t *testing.T) {
+	tests := []struct {
+		line  string
+		shift int
+		want  string
+	}{
+		{line: "# Title", shift: 1, want: "## Title"},
+		{line: "## Title", shift: -1, want: "# Title"},
+		{line: "# Title", shift: -3, want: "# Title"},
+		{line: "##### Title", shift: 3, want: "###### Title"},
+		{line: "#", shift: 1, want: "##"},
+		{line: "# Title", shift: 0, want: "# Title"},
+		{line: "#hashtag", shift: 1, want: "#hashtag"},
+		{line: "####### seven", shift: 1, want: "####### seven"},
+		{line: " # indented", shift: 1, want: " # indented"},
+		{line: "text", shift: 2, want: "text"},
+	}
+	for _, tt := range tests {
+		if got := shiftHeading(tt.line, tt.shift); got != tt.want {
+			t.Errorf("shiftHeading(%q, %d) = %q, want %q", tt.line, tt.shift, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package builder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/lalloni/markr/sourcemap"
+)
+
+const (
+	BeginDelimiter = "{{plantuml"
+	EndDelimiter   = "}}"
+)
+
+// FenceLanguage is the info string language of fenced code blocks taken as
+// diagram macros when they have a file attribute.
+const FenceLanguage = "plantuml"
+
+// macroAttributes are the attributes a macro accepts.
+var macroAttributes = []string{"file", "theme", "config"}
+
+func isMacroStart(line string) bool {
+	return strings.HasPrefix(line, BeginDelimiter)
+}
+
+func isMacroEnd(line string) bool {
+	return strings.HasPrefix(line, EndDelimiter)
+}
+
+// macro is a diagram macro of the markdown input.
+type macro struct {
+	// line is where the macro starts.
+	line int
+	// end is where the macro ends.
+	end   int
+	attrs map[string]string
+	// file is the diagram file the macro loads, if any.
+	file string
+	// config is the plantuml config file the macro uses, if any.
+	config string
+	body   []string
+	// fence closes the macro when it is a fenced code block.
+	fence string
+	// err is the problem found parsing the macro.
+	err error
+}
+
+// parseMacro returns the macro starting at the line number lineno of the input
+// and whether it ends on the same line.
+func parseMacro(input, line string, lineno int) (*macro, bool) {
+	rest := strings.TrimSpace(strings.TrimPrefix(line, BeginDelimiter))
+	closed := strings.HasSuffix(rest, EndDelimiter)
+	rest = strings.TrimSuffix(rest, EndDelimiter)
+	m := &macro{line: lineno, end: lineno}
+	m.attrs, m.err = attributes(rest)
+	if m.err == nil {
+		m.err = m.resolve(input)
+	}
+	if m.err == nil && closed && m.file == "" {
+		m.err = fmt.Errorf("a one line plantuml macro needs a file attribute")
+	}
+	return m, closed
+}
+
+// parseFence returns the macro starting at the line number lineno of the
+// input when the line opens a fenced plantuml code block with a file
+// attribute.
+func parseFence(input, line string, lineno int) (*macro, bool) {
+	fence := openingFence(line)
+	if fence == "" {
+		return nil, false
+	}
+	info := strings.TrimSpace(strings.TrimSpace(line)[len(fence):])
+	if !strings.HasPrefix(info, FenceLanguage+" ") || !strings.Contains(info, "file=") {
+		return nil, false
+	}
+	m := &macro{line: lineno, end: lineno, fence: fence}
+	m.attrs, m.err = attributes(strings.TrimPrefix(info, FenceLanguage))
+	if m.err == nil {
+		m.err = m.resolve(input)
+	}
+	return m, true
+}
+
+// closes tells whether the line ends the macro.
+func (m *macro) closes(line string) bool {
+	if m.fence != "" {
+		return closesFence(m.fence, line)
+	}
+	return isMacroEnd(line)
+}
+
+// resolve checks the macro attributes and locates its file relative to the
+// input.
+func (m *macro) resolve(input string) error {
+	for k := range m.attrs {
+		if !contains(macroAttributes, k) {
+			return fmt.Errorf("unknown plantuml macro attribute %q", k)
+		}
+	}
+	if f, ok := m.attrs["file"]; ok {
+		if f == "" {
+			return fmt.Errorf("empty plantuml macro file attribute")
+		}
+		m.file = relative(input, f)
+	}
+	if c, ok := m.attrs["config"]; ok {
+		if c == "" {
+			return fmt.Errorf("empty plantuml macro config attribute")
+		}
+		m.config = relative(input, c)
+	}
+	return nil
+}
+
+// style returns the style of the macro diagram, which is the base one
+// overridden by the macro attributes.
+func (m *macro) style(base style) style {
+	if t, ok := m.attrs["theme"]; ok {
+		base.theme = t
+	}
+	if m.config != "" {
+		base.config = m.config
+	}
+	return base
+}
+
+// relative returns the path relative to the directory of file, unless it is
+// absolute.
+func relative(file, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(file), path)
+}
+
+// source returns the plantuml source of the macro diagram, taken from its
+// file when it has one, along with the locations of its lines. The @startuml
+// and @enduml markers are added when missing and the style theme and preamble,
+// if any, are included right after @startuml.
+func (m *macro) source(input string, st style) (string, *sourcemap.Map, error) {
+	if m.err != nil {
+		return "", nil, m.err
+	}
+	lines, file, first := m.body, input, m.line+1
+	if m.file != "" {
+		if len(m.body) > 0 {
+			return "", nil, fmt.Errorf("a plantuml macro with a file attribute can't have a body")
+		}
+		content, err := ioutil.ReadFile(m.file)
+		if err != nil {
+			return "", nil, fmt.Errorf("reading diagram file: %v", err)
+		}
+		lines = splitLines(string(content))
+		file, first = m.file, 1
+	}
+	var b strings.Builder
+	var sources sourcemap.Map
+	start := -1
+	for i, l := range lines {
+		if l = strings.TrimSpace(l); l != "" {
+			if strings.HasPrefix(l, "@") {
+				start = i
+			}
+			break
+		}
+	}
+	fixing := start < 0
+	if fixing {
+		b.WriteString("@startuml\n")
+		sources.Add(input, m.line)
+		st.header(&b, &sources, input, m.line)
+	}
+	for i, l := range lines {
+		b.WriteString(l + "\n")
+		sources.Add(file, first+i)
+		if i == start {
+			st.header(&b, &sources, input, m.line)
+		}
+	}
+	if fixing {
+		b.WriteString("@enduml\n")
+		sources.Add(input, m.end)
+	}
+	return b.String(), &sources, nil
+}
+
+// openingFence returns the fence of the fenced code block the line opens, if
+// any. As in CommonMark, fences are indented less than 4 spaces and the info
+// string of backtick fences has no backticks, so inline code isn't a fence.
+func openingFence(line string) string {
+	if !fenceIndent(line) {
+		return ""
+	}
+	trimmed := strings.TrimSpace(line)
+	for _, c := range []string{"`", "~"} {
+		if fence := trimmed[:len(trimmed)-len(strings.TrimLeft(trimmed, c))]; len(fence) >= 3 {
+			if c == "`" && strings.Contains(trimmed[len(fence):], c) {
+				return ""
+			}
+			return fence
+		}
+	}
+	return ""
+}
+
+// fenceIndent tells whether the line is indented little enough to be a fence.
+func fenceIndent(line string) bool {
+	indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+	return len(indent) < 4 && !strings.Contains(indent, "\t")
+}
+
+// closesFence tells whether the line closes the fenced code block opened with
+// fence.
+func closesFence(fence, line string) bool {
+	if !fenceIndent(line) {
+		return false
+	}
+	trimmed := strings.TrimSpace(line)
+	return strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == ""
+}
+
+// attributes parses the space separated key=value pairs of s, whose values
+// may be double quoted.
+func attributes(s string) (map[string]string, error) {
+	attrs := map[string]string{}
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		i := strings.Index(s, "=")
+		if i <= 0 || strings.ContainsAny(s[:i], " \t") {
+			return nil, fmt.Errorf("expecting key=value at %q", s)
+		}
+		key, value := s[:i], ""
+		s = s[i+1:]
+		if strings.HasPrefix(s, `"`) {
+			j := strings.Index(s[1:], `"`)
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated quoted value of %q", key)
+			}
+			value, s = s[1:j+1], s[j+2:]
+		} else {
+			j := strings.IndexAny(s, " \t")
+			if j < 0 {
+				j = len(s)
+			}
+			value, s = s[:j], s[j:]
+		}
+		attrs[key] = value
+	}
+	return attrs, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
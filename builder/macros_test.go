@@ -0,0 +1,116 @@
+package builder
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAttributes(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[string]string
+		wantErr bool
+	}{
+		{in: "", want: map[string]string{}},
+		{in: "file=a.puml", want: map[string]string{"file": "a.puml"}},
+		{in: "  file=a.puml\ttheme=cerulean ", want: map[string]string{"file": "a.puml", "theme": "cerulean"}},
+		{in: `file="with spaces.puml" theme=x`, want: map[string]string{"file": "with spaces.puml", "theme": "x"}},
+		{in: `file=""`, want: map[string]string{"file": ""}},
+		{in: "file=", want: map[string]string{"file": ""}},
+		{in: `file="unterminated`, wantErr: true},
+		{in: "file", wantErr: true},
+		{in: "=value", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := attributes(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("attributes(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("attributes(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestOpeningFence(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{line: "```", want: "```"},
+		{line: "````go", want: "````"},
+		{line: "~~~ plantuml file=a.puml", want: "~~~"},
+		{line: "   ```", want: "```"},
+		{line: "    ```", want: ""},
+		{line: "\t```", want: ""},
+		{line: "``", want: ""},
+		{line: "```x``` is inline", want: ""},
+		{line: "~~~ `backticks` are fine with tildes", want: "~~~"},
+		{line: "text", want: ""},
+		{line: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := openingFence(tt.line); got != tt.want {
+			t.Errorf("openingFence(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestClosesFence(t *testing.T) {
+	tests := []struct {
+		fence, line string
+		want        bool
+	}{
+		{fence: "```", line: "```", want: true},
+		{fence: "```", line: "`````", want: true},
+		{fence: "````", line: "```", want: false},
+		{fence: "```", line: "~~~", want: false},
+		{fence: "```", line: "``` go", want: false},
+		{fence: "~~~", line: "  ~~~  ", want: true},
+		{fence: "```", line: "    ```", want: false},
+	}
+	for _, tt := range tests {
+		if got := closesFence(tt.fence, tt.line); got != tt.want {
+			t.Errorf("closesFence(%q, %q) = %v, want %v", tt.fence, tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseFence(t *testing.T) {
+	tests := []struct {
+		line    string
+		ok      bool
+		fence   string
+		file    string
+		wantErr bool
+	}{
+		{line: "```plantuml", ok: false},
+		{line: "```plantuml title=a", ok: false},
+		{line: "```go file=a.go", ok: false},
+		{line: "```x``` plantuml file=a.puml", ok: false},
+		{line: "```plantuml file=a.puml", ok: true, fence: "```", file: filepath.Join("docs", "a.puml")},
+		{line: "``` plantuml file=a.puml", ok: true, fence: "```", file: filepath.Join("docs", "a.puml")},
+		{line: "~~~~ plantuml file=\"b c.puml\" theme=x", ok: true, fence: "~~~~", file: filepath.Join("docs", "b c.puml")},
+		{line: "``` plantuml file=a.puml color=red", ok: true, fence: "```", wantErr: true},
+		{line: "``` plantuml file=", ok: true, fence: "```", wantErr: true},
+	}
+	for _, tt := range tests {
+		m, ok := parseFence(filepath.Join("docs", "doc.md"), tt.line, 3)
+		if ok != tt.ok {
+			t.Errorf("parseFence(%q) ok = %v, want %v", tt.line, ok, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if (m.err != nil) != tt.wantErr {
+			t.Errorf("parseFence(%q) error = %v, want error %v", tt.line, m.err, tt.wantErr)
+			continue
+		}
+		if m.fence != tt.fence || m.line != 3 || (!tt.wantErr && m.file != tt.file) {
+			t.Errorf("parseFence(%q) = fence %q line %d file %q, want fence %q line 3 file %q", tt.line, m.fence, m.line, m.file, tt.fence, tt.file)
+		}
+	}
+}
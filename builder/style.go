@@ -0,0 +1,88 @@
+package builder
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/lalloni/markr/sourcemap"
+)
+
+// style tells how diagrams look.
+type style struct {
+	// theme is the plantuml theme, included with !theme right after
+	// @startuml.
+	theme string
+	// config is the plantuml configuration file.
+	config   string
+	preamble *preamble
+}
+
+// header appends what the style includes right after @startuml to b
+// recording the locations of its lines, which are at line of input unless
+// they come from a file.
+func (s style) header(b *strings.Builder, sources *sourcemap.Map, input string, line int) {
+	if s.theme != "" {
+		b.WriteString("!theme " + s.theme + "\n")
+		sources.Add(input, line)
+	}
+	s.preamble.write(b, sources)
+}
+
+// key returns the checksum identifying the diagram source rendered with the
+// style in the format at the resolution, and the plantuml arguments it needs.
+func (s style) key(source, format string, dpi int) (string, []string, error) {
+	h := sha1.New()
+	h.Write([]byte(source))
+	if format == "png" || format == "pdf" {
+		fmt.Fprintf(h, "\x00dpi=%d", dpi)
+	}
+	var args []string
+	if s.config != "" {
+		content, err := ioutil.ReadFile(s.config)
+		if err != nil {
+			return "", nil, fmt.Errorf("reading plantuml config: %v", err)
+		}
+		h.Write(content)
+		args = append(args, "-config", s.config)
+	}
+	return hex.EncodeToString(h.Sum(nil)), args, nil
+}
+
+// preamble is the plantuml source included right after @startuml in every
+// diagram.
+type preamble struct {
+	file  string
+	lines []string
+}
+
+// loadPreamble reads the preamble from file, returning none when file is
+// empty.
+func loadPreamble(file string) (*preamble, error) {
+	if file == "" {
+		return nil, nil
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading plantuml preamble: %w", err)
+	}
+	return &preamble{file: file, lines: splitLines(string(content))}, nil
+}
+
+// write appends the preamble lines to b recording their locations.
+func (p *preamble) write(b *strings.Builder, sources *sourcemap.Map) {
+	if p == nil {
+		return
+	}
+	for i, l := range p.lines {
+		b.WriteString(l + "\n")
+		sources.Add(p.file, i+1)
+	}
+}
+
+// splitLines returns the lines of content.
+func splitLines(content string) []string {
+	return strings.Split(strings.TrimSuffix(strings.Replace(content, "\r\n", "\n", -1), "\n"), "\n")
+}
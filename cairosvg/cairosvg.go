@@ -0,0 +1,28 @@
+package cairosvg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+
+	"github.com/lalloni/markr/logging"
+	"github.com/lalloni/markr/options"
+	"github.com/lalloni/markr/processes"
+)
+
+func ConvertToPDF(ctx context.Context, input io.Reader, output io.Writer) error {
+	log := logging.ZapLogger(ctx)
+	log.Info("rendering with cairosvg")
+	logger := logging.LoggerWriter(log, "cairosvg")
+	defer logger.Close()
+	ctx, cancel := processes.WithTimeout(ctx, options.Get(ctx).ConverterTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "cairosvg", "-", "--format", "pdf", "--dpi", strconv.Itoa(options.Get(ctx).DiagramsDPI), "--output", "-")
+	err := processes.Pipe(ctx, "cairosvg", cmd, input, output, logger)
+	if err != nil {
+		return fmt.Errorf("rendering with cairosvg: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package converters
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/lalloni/markr/cairosvg"
+	"github.com/lalloni/markr/inkscape"
+	"github.com/lalloni/markr/rsvg"
+)
+
+// Auto is the converter name that selects the first available converter.
+const Auto = "auto"
+
+// Converter converts SVG diagrams to PDF.
+type Converter interface {
+	Name() string
+	Available() bool
+	ConvertToPDF(ctx context.Context, input io.Reader, output io.Writer) error
+}
+
+type tool struct {
+	name    string
+	convert func(context.Context, io.Reader, io.Writer) error
+}
+
+func (t tool) Name() string {
+	return t.name
+}
+
+func (t tool) Available() bool {
+	_, err := exec.LookPath(t.name)
+	return err == nil
+}
+
+func (t tool) ConvertToPDF(ctx context.Context, input io.Reader, output io.Writer) error {
+	return t.convert(ctx, input, output)
+}
+
+// converters are listed in order of preference.
+var converters = []Converter{
+	tool{name: "inkscape", convert: inkscape.ConvertToPDF},
+	tool{name: "rsvg-convert", convert: rsvg.ConvertToPDF},
+	tool{name: "cairosvg", convert: cairosvg.ConvertToPDF},
+}
+
+func Names() []string {
+	names := make([]string, len(converters))
+	for i, c := range converters {
+		names[i] = c.Name()
+	}
+	return names
+}
+
+// Select returns the named converter after checking it is available or, when
+// name is Auto, the first available one.
+func Select(name string) (Converter, error) {
+	if name == Auto {
+		for _, c := range converters {
+			if c.Available() {
+				return c, nil
+			}
+		}
+		return nil, fmt.Errorf("no SVG to PDF converter found (install one of %s): %w", strings.Join(Names(), ", "), exec.ErrNotFound)
+	}
+	for _, c := range converters {
+		if c.Name() == name {
+			if !c.Available() {
+				return nil, fmt.Errorf("SVG to PDF converter %q not found in PATH: %w", name, exec.ErrNotFound)
+			}
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown SVG to PDF converter %q (known converters are %s)", name, strings.Join(Names(), ", "))
+}
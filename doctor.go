@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/lalloni/markr/converters"
+	"github.com/lalloni/markr/fileutils"
+	"github.com/lalloni/markr/logging"
+	"github.com/lalloni/markr/options"
+	"github.com/lalloni/markr/pandoc"
+	"github.com/lalloni/markr/plantuml"
+	"github.com/lalloni/markr/processes"
+)
+
+const doctorDiagram = `@startuml
+actor Writer
+Writer -> markr : document
+markr -> pandoc : markdown
+@enduml
+`
+
+const doctorDocument = `# markr doctor
+
+Text in the main font, ` + "`code in the monospaced font`" + ` and a diagram:
+
+![](%s)
+`
+
+var doctorFonts = []struct {
+	name       string
+	suggestion string
+}{
+	{pandoc.MainFont, "install the fonts-ubuntu package or download it from https://design.ubuntu.com/font/"},
+	{pandoc.MonoFont, "download it from https://github.com/be5invis/Iosevka/releases/"},
+}
+
+// transcript keeps what a doctor step logged, to be shown when it fails.
+type transcript struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (t *transcript) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.buf.Write(p)
+}
+
+func (t *transcript) Sync() error {
+	return nil
+}
+
+func (t *transcript) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf.Reset()
+}
+
+func (t *transcript) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.buf.String()
+}
+
+type doctor struct {
+	ctx        context.Context
+	transcript *transcript
+	failed     bool
+}
+
+func (d *doctor) step(name string, f func() error) bool {
+	d.transcript.Reset()
+	err := f()
+	if err != nil {
+		d.failed = true
+		fmt.Printf("FAIL  %s: %v\n", name, err)
+		// the tool error output may still be on its way to the transcript
+		var lines []string
+		var terr *processes.ExternalToolError
+		if errors.As(err, &terr) {
+			lines = terr.StderrLines()
+		} else if out := strings.TrimSpace(d.transcript.String()); out != "" {
+			lines = strings.Split(out, "\n")
+		}
+		for _, l := range lines {
+			fmt.Printf("        %s\n", l)
+		}
+		return false
+	}
+	fmt.Printf("ok    %s\n", name)
+	return true
+}
+
+func (d *doctor) skip(name, reason string) {
+	fmt.Printf("skip  %s: %s\n", name, reason)
+}
+
+func (d *doctor) note(name, note string) {
+	fmt.Printf("note  %s: %s\n", name, note)
+}
+
+func runDoctor(args []string) int {
+	fs := flag.NewFlagSet("markr doctor", flag.ContinueOnError)
+	opts := options.ConfigureToolFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	ctx := options.WithOptions(context.Background(), opts)
+
+	t := &transcript{}
+	core := zapcore.NewCore(zapcore.NewConsoleEncoder(zapcore.EncoderConfig{MessageKey: "msg"}), t, zap.InfoLevel)
+	if opts.Verbose {
+		logger, err := newLogger(true)
+		if err != nil {
+			panic(err)
+		}
+		core = zapcore.NewTee(core, logger.Core())
+	}
+	logger := zap.New(core)
+	defer logger.Sync()
+	ctx = logging.WithZapLogger(ctx, logger)
+
+	ctx, cancel := interruptible(ctx)
+	defer cancel()
+
+	ctx, err := fileutils.WithWorkspace(ctx, false)
+	if err != nil {
+		fmt.Printf("FAIL  %v\n", err)
+		return exitFailure
+	}
+	defer fileutils.Cleanup(ctx)
+
+	d := &doctor{ctx: ctx, transcript: t}
+	d.run()
+	if d.failed {
+		return exitFailure
+	}
+	return exitOK
+}
+
+func (d *doctor) run() {
+	ctx := d.ctx
+	opts := options.Get(ctx)
+
+	var engine pandoc.Engine
+	engineOK := d.step("pandoc: checking PDF engine "+opts.PDFEngine, func() (err error) {
+		engine, err = pandoc.CheckEngine(ctx, opts.PDFEngine)
+		return err
+	})
+
+	var svg bytes.Buffer
+	svgOK := d.step("plantuml: rendering SVG", func() error {
+		err := plantuml.Render(ctx, strings.NewReader(doctorDiagram), &svg, "svg")
+		if err != nil {
+			return err
+		}
+		if !bytes.Contains(svg.Bytes(), []byte("<svg")) {
+			return fmt.Errorf("output is not an SVG document")
+		}
+		return nil
+	})
+
+	diagram := fileutils.TempFileName(ctx, "diagram", "doctor", "svg")
+	var diagramOK bool
+	switch {
+	case !svgOK:
+		d.skip("converting diagram", "plantuml failed")
+	case engineOK && engine.HTML:
+		diagramOK = d.step("writing SVG diagram", func() error {
+			return ioutil.WriteFile(diagram, svg.Bytes(), 0600)
+		})
+	default:
+		diagram = fileutils.ChangeExtension(diagram, "pdf")
+		var pdf bytes.Buffer
+		if opts.PDFNative {
+			if plantuml.SupportsPDF(ctx) {
+				d.note("plantuml: rendering PDF", "supported natively, no SVG to PDF converter needed")
+				diagramOK = d.step("plantuml: rendering PDF", func() error {
+					return plantuml.Render(ctx, strings.NewReader(doctorDiagram), &pdf, "pdf")
+				})
+			} else {
+				d.note("plantuml: rendering PDF", "not supported by this plantuml, an SVG to PDF converter is needed")
+			}
+		}
+		if pdf.Len() == 0 {
+			var converter converters.Converter
+			diagramOK = d.step("selecting SVG to PDF converter "+opts.Converter, func() (err error) {
+				converter, err = converters.Select(opts.Converter)
+				return err
+			})
+			if diagramOK {
+				diagramOK = d.step(converter.Name()+": converting SVG to PDF", func() error {
+					err := converter.ConvertToPDF(ctx, &svg, &pdf)
+					if err != nil {
+						return err
+					}
+					if !bytes.HasPrefix(pdf.Bytes(), []byte("%PDF-")) {
+						return fmt.Errorf("output is not a PDF document")
+					}
+					return nil
+				})
+			}
+		}
+		if diagramOK {
+			diagramOK = d.step("writing PDF diagram", func() error {
+				return ioutil.WriteFile(diagram, pdf.Bytes(), 0600)
+			})
+		}
+	}
+
+	document := fileutils.TempFileName(ctx, "document", "doctor", "pdf")
+	switch {
+	case !engineOK:
+		d.skip("pandoc: rendering PDF", "PDF engine not usable")
+	case !diagramOK:
+		d.skip("pandoc: rendering PDF", "diagram not available")
+	default:
+		d.step("pandoc: rendering PDF with "+engine.Name, func() error {
+			err := pandoc.RenderMarkdown(ctx, strings.NewReader(fmt.Sprintf(doctorDocument, diagram)), document)
+			if err != nil {
+				return err
+			}
+			content, err := ioutil.ReadFile(document)
+			if err != nil {
+				return fmt.Errorf("reading rendered document: %v", err)
+			}
+			if !bytes.HasPrefix(content, []byte("%PDF-")) {
+				return fmt.Errorf("output is not a PDF document")
+			}
+			return nil
+		})
+	}
+
+	if engineOK && !engine.Fonts {
+		return
+	}
+	var families string
+	if !d.step("fc-list: listing fonts", func() error {
+		out, err := processes.Output(ctx, exec.CommandContext(ctx, "fc-list", ":", "family"))
+		families = string(out)
+		return err
+	}) {
+		return
+	}
+	for _, font := range doctorFonts {
+		if hasFontFamily(families, font.name) {
+			fmt.Printf("ok    font %s\n", font.name)
+		} else {
+			d.failed = true
+			fmt.Printf("FAIL  font %s: not installed (%s)\n", font.name, font.suggestion)
+		}
+	}
+}
+
+func hasFontFamily(families, family string) bool {
+	for _, line := range strings.Split(families, "\n") {
+		for _, f := range strings.Split(line, ",") {
+			if strings.EqualFold(strings.TrimSpace(f), family) {
+				return true
+			}
+		}
+	}
+	return false
+}
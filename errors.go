@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/lalloni/markr/builder"
+)
+
+// Exit statuses.
+const (
+	exitOK            = 0
+	exitFailure       = 1
+	exitUsage         = 2
+	exitInputNotFound = 3
+	exitDiagram       = 4
+	exitPandoc        = 5
+	exitToolMissing   = 6
+)
+
+// status returns the exit status caused by the build error kind.
+func status(kind builder.Kind) int {
+	switch kind {
+	case builder.Usage:
+		return exitUsage
+	case builder.InputNotFound:
+		return exitInputNotFound
+	case builder.Diagram:
+		return exitDiagram
+	case builder.Pandoc:
+		return exitPandoc
+	case builder.ToolMissing:
+		return exitToolMissing
+	}
+	return exitFailure
+}
+
+// asBuildError returns err as a build error, making it a generic failure if it
+// is not one.
+func asBuildError(err error) *builder.Error {
+	var berr *builder.Error
+	if !errors.As(err, &berr) {
+		berr = builder.NewError(builder.Failure, "building", err)
+	}
+	return berr
+}
+
+// report writes the error to the standard error in the format ("text" or
+// "json") and returns the exit status it causes.
+func report(err error, format string) int {
+	berr := asBuildError(err)
+	if format == "json" {
+		e := json.NewEncoder(os.Stderr)
+		e.SetEscapeHTML(false)
+		e.Encode(struct {
+			Status  int      `json:"status"`
+			Stage   string   `json:"stage"`
+			Error   string   `json:"error"`
+			Details []string `json:"details,omitempty"`
+		}{status(berr.Kind), berr.Stage, berr.Err.Error(), berr.Details})
+		return status(berr.Kind)
+	}
+	fmt.Fprint(os.Stderr, berr.Text())
+	return status(berr.Kind)
+}
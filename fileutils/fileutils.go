@@ -2,8 +2,11 @@ package fileutils
 
 import (
 	"context"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 
 	"go.uber.org/zap"
@@ -11,34 +14,88 @@ import (
 	"github.com/lalloni/markr/logging"
 )
 
-var (
-	deletes []string
-)
+// Workspace is the private directory keeping the intermediate files of some
+// work, like a build.
+type Workspace struct {
+	Dir  string
+	keep bool
+}
 
-func DoDeletes(ctx context.Context) {
-	for _, file := range deletes {
-		Delete(ctx, file)
+type contextKey struct{}
+
+// WithWorkspace creates a new workspace, which Cleanup removes unless keep is
+// true, and returns a context carrying it.
+func WithWorkspace(ctx context.Context, keep bool) (context.Context, error) {
+	dir, err := ioutil.TempDir("", "markr-")
+	if err != nil {
+		return ctx, fmt.Errorf("creating workspace: %v", err)
 	}
+	logging.ZapLogger(ctx).Info("created workspace", zap.String("dir", dir))
+	return context.WithValue(ctx, contextKey{}, &Workspace{Dir: dir, keep: keep}), nil
 }
 
-func AddDelete(ctx context.Context, file string) {
-	log := logging.ZapLogger(ctx)
-	log.Info("adding delete", zap.String("file", file))
-	deletes = append(deletes, file)
+// Current returns the workspace carried by the context.
+func Current(ctx context.Context) *Workspace {
+	return ctx.Value(contextKey{}).(*Workspace)
 }
 
-func Delete(ctx context.Context, file string) error {
+// Cleanup removes the workspace carried by the context with everything in it,
+// unless it must be kept.
+func Cleanup(ctx context.Context) {
 	log := logging.ZapLogger(ctx)
-	log.Info("deleting", zap.String("file", file))
-	return os.Remove(file)
+	w := Current(ctx)
+	if w.keep {
+		log.Warn("keeping workspace", zap.String("dir", w.Dir))
+		return
+	}
+	log.Info("removing workspace", zap.String("dir", w.Dir))
+	if err := os.RemoveAll(w.Dir); err != nil {
+		log.Warn("removing workspace", zap.String("dir", w.Dir), zap.Error(err))
+	}
 }
 
-func NewTempFileName(base, kind, id, ext string) string {
-	return path.Join(os.TempDir(), base+"-"+kind+"-"+id+"."+ext)
+// TempFileName returns the name of an intermediate file in the workspace
+// carried by the context.
+func TempFileName(ctx context.Context, kind, id, ext string) string {
+	return filepath.Join(Current(ctx).Dir, kind+"-"+id+"."+ext)
 }
 
-func NewTempFile(base, kind, id, ext string) (*os.File, error) {
-	return os.Create(NewTempFileName(base, kind, id, ext))
+// Copy copies the file src to dst, creating its directory when missing.
+func Copy(src, dst string) error {
+	content, err := ioutil.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("reading %q: %v", src, err)
+	}
+	err = os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return fmt.Errorf("creating directory of %q: %v", dst, err)
+	}
+	err = WriteFile(dst, content, 0644)
+	if err != nil {
+		return fmt.Errorf("writing %q: %v", dst, err)
+	}
+	return nil
+}
+
+// WriteFile writes the content to file through a temporary file in the same
+// directory, so that the file is either missing or complete for others.
+func WriteFile(file string, content []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(content)
+	if err == nil {
+		err = tmp.Chmod(perm)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
 }
 
 func ChangeExtension(file string, ext string) string {
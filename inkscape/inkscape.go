@@ -10,17 +10,31 @@ import (
 	"github.com/lalloni/markr/logging"
 	"github.com/lalloni/markr/options"
 	"github.com/lalloni/markr/processes"
+	"github.com/lalloni/markr/versions"
 )
 
+func arguments(v versions.Version, dpi int) []string {
+	if v.Major == 0 {
+		return []string{"--without-gui", "--export-dpi", strconv.Itoa(dpi), "--file", "/dev/stdin", "--export-pdf", "/dev/stdout"}
+	}
+	return []string{"--pipe", "--export-dpi=" + strconv.Itoa(dpi), "--export-type=pdf", "--export-filename=-"}
+}
+
 func ConvertToPDF(ctx context.Context, input io.Reader, output io.Writer) error {
 	log := logging.ZapLogger(ctx)
+	v, err := Version(ctx)
+	if err != nil {
+		return fmt.Errorf("rendering with inkscape: %w", err)
+	}
 	log.Info("rendering with inkscape")
 	logger := logging.LoggerWriter(log, "inkscape")
 	defer logger.Close()
-	cmd := exec.Command("inkscape", "--without-gui", "--export-dpi", strconv.Itoa(options.Get(ctx).DiagramsDPI), "--file", "/dev/stdin", "--export-pdf", "/dev/stdout")
-	err := processes.Pipe(ctx, cmd, input, output, logger)
+	ctx, cancel := processes.WithTimeout(ctx, options.Get(ctx).ConverterTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "inkscape", arguments(v, options.Get(ctx).DiagramsDPI)...)
+	err = processes.Pipe(ctx, "inkscape", cmd, input, output, logger)
 	if err != nil {
-		return fmt.Errorf("rendering with inkscape: %v", err)
+		return fmt.Errorf("rendering with inkscape: %w", err)
 	}
 	return nil
 }
@@ -0,0 +1,46 @@
+package inkscape
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/lalloni/markr/logging"
+	"github.com/lalloni/markr/processes"
+	"github.com/lalloni/markr/versions"
+)
+
+var detected versions.Cache
+
+// Version returns the version of the inkscape found in PATH, running
+// `inkscape --version` only until it is detected for that binary.
+func Version(ctx context.Context) (versions.Version, error) {
+	return detected.Get("inkscape", func(bin string) (versions.Version, error) {
+		return detectVersion(ctx, bin)
+	})
+}
+
+func detectVersion(ctx context.Context, bin string) (versions.Version, error) {
+	log := logging.ZapLogger(ctx)
+	out, err := processes.Output(ctx, exec.CommandContext(ctx, bin, "--version"))
+	if err != nil {
+		return versions.Version{}, fmt.Errorf("detecting inkscape version: %w", err)
+	}
+	// inkscape may print warnings before the version line
+	line := string(out)
+	for _, l := range strings.Split(line, "\n") {
+		if strings.HasPrefix(l, "Inkscape ") {
+			line = l
+			break
+		}
+	}
+	v, err := versions.Parse(line)
+	if err != nil {
+		return versions.Version{}, fmt.Errorf("parsing inkscape version: %v", err)
+	}
+	log.Info("detected inkscape", zap.Stringer("version", v))
+	return v, nil
+}
@@ -0,0 +1,91 @@
+package latex
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Error is an error reported by a LaTeX engine.
+type Error struct {
+	Message string
+	// Context is the part of the offending LaTeX line up to the error.
+	Context string
+	// Culprit is the construct causing the error, when known.
+	Culprit string
+}
+
+func (e Error) String() string {
+	if e.Culprit == "" {
+		return e.Message
+	}
+	return e.Message + " " + e.Culprit
+}
+
+var (
+	contextPattern = regexp.MustCompile(`^l\.\d+ (.*)$`)
+	commandPattern = regexp.MustCompile(`\\[A-Za-z@]+\*?`)
+	glyphPattern   = regexp.MustCompile(`Missing character: There is no (\S+)`)
+	markupPattern  = regexp.MustCompile(`\\[A-Za-z@]+\*?|[{}$^_&#~]`)
+)
+
+// contextLines is how many lines after an error message are looked at for
+// finding its context.
+const contextLines = 8
+
+// Parse finds the errors in the output of a LaTeX engine (or pandoc running
+// one).
+func Parse(output string) []Error {
+	var errs []Error
+	lines := strings.Split(strings.Replace(output, "\r\n", "\n", -1), "\n")
+	for i, l := range lines {
+		if m := glyphPattern.FindStringSubmatch(l); m != nil {
+			errs = append(errs, Error{
+				Message: "Missing character",
+				Context: m[1],
+				Culprit: m[1],
+			})
+			continue
+		}
+		if !strings.HasPrefix(l, "! ") {
+			continue
+		}
+		e := Error{Message: strings.TrimSuffix(strings.TrimSpace(l[2:]), ".")}
+		for j := i + 1; j < len(lines) && j <= i+contextLines; j++ {
+			if strings.HasPrefix(lines[j], "! ") {
+				break
+			}
+			if m := contextPattern.FindStringSubmatch(lines[j]); m != nil {
+				e.Context = m[1]
+				if cs := commandPattern.FindAllString(m[1], -1); len(cs) > 0 && e.Message == "Undefined control sequence" {
+					e.Culprit = cs[len(cs)-1]
+				}
+				break
+			}
+		}
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+// Locate returns the index of the first of the lines containing the construct
+// which caused the error, or -1 when it can't be found.
+func Locate(e Error, lines []string) int {
+	var needles []string
+	if e.Culprit != "" {
+		needles = append(needles, e.Culprit)
+	}
+	if words := strings.Fields(markupPattern.ReplaceAllString(e.Context, " ")); len(words) > 0 {
+		if len(words) > 3 {
+			words = words[len(words)-3:]
+		}
+		needles = append(needles, strings.Join(words, " "), words[len(words)-1])
+	}
+	for _, needle := range needles {
+		for i, l := range lines {
+			if strings.Contains(l, needle) {
+				return i
+			}
+		}
+	}
+	return -1
+}
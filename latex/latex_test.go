@@ -0,0 +1,78 @@
+package latex
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []Error
+	}{
+		{
+			name:   "undefined control sequence",
+			output: "! Undefined control sequence.\nl.42 Some text \\foo\n                 {bar}\n",
+			want:   []Error{{Message: "Undefined control sequence", Context: "Some text \\foo", Culprit: "\\foo"}},
+		},
+		{
+			name:   "other error keeps no culprit",
+			output: "! Missing $ inserted.\n<inserted text>\n                $\nl.7 x_1\n",
+			want:   []Error{{Message: "Missing $ inserted", Context: "x_1"}},
+		},
+		{
+			name:   "context missing",
+			output: "! Emergency stop.\n",
+			want:   []Error{{Message: "Emergency stop"}},
+		},
+		{
+			name:   "context of the next error is not taken",
+			output: "! First problem.\n! Second problem.\nl.3 text\n",
+			want:   []Error{{Message: "First problem"}, {Message: "Second problem", Context: "text"}},
+		},
+		{
+			name:   "missing character",
+			output: "Missing character: There is no ★ in font lmroman10-regular!\n",
+			want:   []Error{{Message: "Missing character", Context: "★", Culprit: "★"}},
+		},
+		{
+			name:   "crlf",
+			output: "! Undefined control sequence.\r\nl.1 \\bar\r\n",
+			want:   []Error{{Message: "Undefined control sequence", Context: "\\bar", Culprit: "\\bar"}},
+		},
+		{
+			name:   "no errors",
+			output: "This is XeTeX\nOutput written on doc.pdf\n",
+		},
+	}
+	for _, tt := range tests {
+		if got := Parse(tt.output); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Parse() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLocate(t *testing.T) {
+	lines := []string{
+		"# Title",
+		"Some text \\foo here",
+		"Math $x_1$ and more words",
+	}
+	tests := []struct {
+		name string
+		err  Error
+		want int
+	}{
+		{name: "culprit", err: Error{Culprit: "\\foo", Context: "unrelated"}, want: 1},
+		{name: "context words", err: Error{Context: "and more words"}, want: 2},
+		{name: "last context word", err: Error{Context: "\\textbf{Title}"}, want: 0},
+		{name: "not found", err: Error{Context: "nowhere"}, want: -1},
+		{name: "no context", err: Error{Message: "Emergency stop"}, want: -1},
+	}
+	for _, tt := range tests {
+		if got := Locate(tt.err, lines); got != tt.want {
+			t.Errorf("%s: Locate() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -8,16 +8,14 @@ import (
 	"go.uber.org/zap"
 )
 
-const (
-	zapLogger = "zap.Logger"
-)
+type contextKey struct{}
 
 func WithZapLogger(ctx context.Context, logger *zap.Logger) context.Context {
-	return context.WithValue(ctx, zapLogger, logger)
+	return context.WithValue(ctx, contextKey{}, logger)
 }
 
 func ZapLogger(ctx context.Context) *zap.Logger {
-	return ctx.Value(zapLogger).(*zap.Logger)
+	return ctx.Value(contextKey{}).(*zap.Logger)
 }
 
 func LoggerWriter(logger *zap.Logger, prefix string) io.WriteCloser {
@@ -1,217 +1,166 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"context"
-	"crypto/sha1"
-	"encoding/hex"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
 
 	"go.uber.org/zap"
 
-	"github.com/lalloni/markr/fileutils"
-	"github.com/lalloni/markr/inkscape"
+	"github.com/lalloni/markr/builder"
 	"github.com/lalloni/markr/logging"
 	"github.com/lalloni/markr/options"
 	"github.com/lalloni/markr/pandoc"
-	"github.com/lalloni/markr/plantuml"
 )
 
-const (
-	BeginDelimiter = "{{plantuml"
-	EndDelimiter   = "}}"
-)
-
-func isMacroStart(line string) bool {
-	return strings.HasPrefix(line, BeginDelimiter)
-}
-
-func isMacroEnd(line string) bool {
-	return strings.HasPrefix(line, EndDelimiter)
-}
-
-func generatePDF(ctx context.Context, uml io.Reader, diagram string) error {
-	var svg bytes.Buffer
-	err := plantuml.Render(ctx, uml, &svg, "svg")
-	if err != nil {
-		return fmt.Errorf("rendering with plantuml: %v", err)
-	}
-	var pdf bytes.Buffer
-	err = inkscape.ConvertToPDF(ctx, &svg, &pdf)
-	if err != nil {
-		return fmt.Errorf("converting with inkscape: %v", err)
-	}
-	err = ioutil.WriteFile(diagram, pdf.Bytes(), 0600)
-	if err != nil {
-		return fmt.Errorf("writing PDF file: %v", err)
+func newLogger(verbose bool) (*zap.Logger, error) {
+	loggerConfig := zap.NewDevelopmentConfig()
+	loggerConfig.EncoderConfig.EncodeCaller = nil
+	if !verbose {
+		loggerConfig.Level.SetLevel(zap.WarnLevel)
+		loggerConfig.DisableStacktrace = true
 	}
-	return nil
+	return loggerConfig.Build()
 }
 
-func generateEPS(ctx context.Context, uml io.Reader, diagram string) error {
-	var eps bytes.Buffer
-	err := plantuml.Render(ctx, uml, &eps, "eps")
-	if err != nil {
-		return fmt.Errorf("rendering with plantuml: %v", err)
-	}
-	err = ioutil.WriteFile(diagram, eps.Bytes(), 0600)
-	if err != nil {
-		return fmt.Errorf("writing PDF file: %v", err)
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "tools":
+			os.Exit(runTools(os.Args[2:]))
+		case "doctor":
+			os.Exit(runDoctor(os.Args[2:]))
+		case "watch":
+			os.Exit(runWatch(os.Args[2:]))
+		case "serve":
+			os.Exit(runServe(os.Args[2:]))
+		}
 	}
-	return nil
+	os.Exit(run())
 }
 
-func main() {
-	options.ConfigureFlags()
+func run() int {
+	opts := options.ConfigureFlags(flag.CommandLine)
 	flag.Parse()
 
 	ctx := context.Background()
 
-	ctx = options.WithOptions(ctx)
-	opts := options.Get(ctx)
+	ctx = options.WithOptions(ctx, opts)
 
 	if opts.Usage {
 		flag.Usage()
-		return
+		return exitOK
 	}
 
-	loggerConfig := zap.NewDevelopmentConfig()
-	loggerConfig.EncoderConfig.EncodeCaller = nil
-	if !opts.Verbose {
-		loggerConfig.Level.SetLevel(zap.ErrorLevel)
+	if err := checkOptions(opts, true); err != nil {
+		fmt.Fprintf(os.Stderr, "markr: %v\n", err)
+		flag.Usage()
+		return exitUsage
 	}
-	logger, err := loggerConfig.Build()
+
+	logger, err := newLogger(opts.Verbose)
 	if err != nil {
 		panic(err)
 	}
 	defer logger.Sync()
-	log := logger.Sugar()
 	ctx = logging.WithZapLogger(ctx, logger)
 
-	defer fileutils.DoDeletes(ctx)
+	ctx, cancel := interruptible(ctx)
+	defer cancel()
 
-	inf, err := os.Open(opts.InputFile)
+	_, err = build(ctx)
 	if err != nil {
-		log.Errorw("opening file for reading", "file", opts.InputFile)
-		return
+		return report(err, opts.ErrorFormat)
 	}
-	defer inf.Close()
 
-	var markdown, uml bytes.Buffer
-	var base, line, lineprev string
-	var fixingPlantUML bool
+	return exitOK
+}
 
-	{
-		sha1 := sha1.Sum([]byte(opts.InputFile))
-		base = "markr-" + hex.EncodeToString(sha1[:])
+// checkOptions verifies the options, which must include an output file when
+// output is true.
+func checkOptions(opts *options.Options, output bool) error {
+	if opts.ErrorFormat != "text" && opts.ErrorFormat != "json" {
+		return fmt.Errorf("unknown error format %q", opts.ErrorFormat)
 	}
+	if output && (opts.InputFile == "" || opts.OutputFile == "") {
+		return fmt.Errorf("both -in and -out are required")
+	}
+	if opts.InputFile == "" {
+		return fmt.Errorf("-in is required")
+	}
+	return nil
+}
 
-	macro := false
-	ins := bufio.NewScanner(bufio.NewReader(inf))
-	for ins.Scan() {
-		lineprev = line
-		line = ins.Text()
-		log.Infow("read", "line", line)
-		if macro {
-
-			if isMacroEnd(line) {
-
-				log.Info("macro end")
-
-				if fixingPlantUML {
-					log.Info("generating @enduml marker")
-					uml.WriteString("@enduml\n")
-				}
-
-				sha1 := sha1.Sum(uml.Bytes())
-				sha1hex := hex.EncodeToString(sha1[:])
-				log.Infow("uml source checksum", "sha1", sha1hex)
-
-				diagram := fileutils.NewTempFileName(base, "diagram", sha1hex, opts.Diagrams)
-
-				if _, err = os.Stat(diagram); opts.Cache && os.IsNotExist(err) || !opts.Cache {
-
-					switch opts.Diagrams {
-					case "pdf":
-						err = generatePDF(ctx, &uml, diagram)
-					case "eps":
-						err = generateEPS(ctx, &uml, diagram)
-					default:
-						err = fmt.Errorf("unknown diagram format: %q", opts.Diagrams)
-					}
-
-					if err != nil {
-						log.Errorw("generating diagram", "error", err, "source", uml.String())
-						return
-					}
-
-					if !opts.Cache {
-						fileutils.AddDelete(ctx, diagram)
-					} else {
-						log.Infow("keeping for cache", "file", diagram)
-					}
-
-				}
-
-				log.Infow("using diagram", "file", diagram)
-				_, err = fmt.Fprintf(&markdown, "![](%s)\n", diagram)
-				if err != nil {
-					log.Errorw("writing to output", "error", err)
-					return
-				}
-
-				uml.Reset()
-				macro = false
-				fixingPlantUML = false
-
-			} else {
-
-				if isMacroStart(lineprev) && line[0:1] != "@" {
-					log.Info("generating @startuml marker")
-					fixingPlantUML = true
-					uml.WriteString("@startuml\n")
-				}
-				log.Info("keeping plantuml line")
-				uml.Write([]byte(line))
-				uml.Write([]byte("\n"))
-
-			}
-
-		} else {
-
-			// not in macro
-
-			if isMacroStart(line) {
-				log.Info("starting plantuml macro")
-				macro = true
-				continue
-			}
-
-			log.Info("copying line")
-			_, err = markdown.WriteString(line + "\n")
-			if err != nil {
-				log.Errorw("writing to output", "error", err)
-				return
-			}
-
+// interruptible returns a context cancelled when markr is interrupted or
+// terminated.
+func interruptible(ctx context.Context) (context.Context, context.CancelFunc) {
+	log := logging.ZapLogger(ctx).Sugar()
+	ctx, cancel := context.WithCancel(ctx)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Warnw("interrupted, stopping", "signal", sig)
+			cancel()
+		case <-ctx.Done():
 		}
-	}
+		signal.Stop(signals)
+	}()
+	return ctx, cancel
+}
 
-	if ins.Err() != nil {
-		log.Errorw("reading input file", "error", ins.Err())
-		return
+// config returns the build configuration given by the options.
+func config(opts *options.Options, logger *zap.Logger) builder.Config {
+	return builder.Config{
+		InputName: opts.InputFile,
+		Settings:  opts.Settings,
+		Logger:    logger,
 	}
+}
 
-	err = pandoc.RenderMarkdown(ctx, &markdown, opts.OutputFile)
+// build builds the input file to the output file as the options say.
+func build(ctx context.Context) (builder.Result, error) {
+	opts := options.Get(ctx)
+	cfg := config(opts, logging.ZapLogger(ctx))
+	target, err := pandoc.TargetFor(opts.OutputFile)
 	if err != nil {
-		log.Errorw("rendering markdown", "error", err)
-		return
+		return builder.Result{Dependencies: []string{opts.InputFile}}, builder.NewError(builder.Usage, "checking output file", err)
+	}
+	cfg.Format = target.Name
+	if target.Links {
+		// diagrams must outlive the build, next to the output
+		cfg.DiagramsDir = strings.TrimSuffix(opts.OutputFile, filepath.Ext(opts.OutputFile)) + "-diagrams"
+		cfg.DiagramsURL = filepath.Base(cfg.DiagramsDir) + "/"
+	}
+	var out bytes.Buffer
+	result, err := buildInput(ctx, cfg, &out)
+	if out.Len() > 0 {
+		if werr := ioutil.WriteFile(opts.OutputFile, out.Bytes(), 0644); werr != nil {
+			return result, builder.NewError(builder.Failure, "writing output file", werr)
+		}
 	}
+	return result, err
+}
 
+// buildInput builds the input file named in the configuration to output.
+func buildInput(ctx context.Context, cfg builder.Config, output io.Writer) (builder.Result, error) {
+	inf, err := os.Open(cfg.InputName)
+	if err != nil {
+		result := builder.Result{Dependencies: []string{cfg.InputName}}
+		if os.IsNotExist(err) {
+			return result, builder.NewError(builder.InputNotFound, "opening input file", err)
+		}
+		return result, builder.NewError(builder.Failure, "opening input file", err)
+	}
+	defer inf.Close()
+	return builder.Build(ctx, cfg, inf, output)
 }
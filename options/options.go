@@ -3,36 +3,111 @@ package options
 import (
 	"context"
 	"flag"
+	"os"
+	"time"
 )
 
+// Settings tell how to build a document and run the tools doing it.
+type Settings struct {
+	// Diagrams is the diagrams format: "eps", "pdf", "svg", "png" or empty for
+	// the best fit for the output format.
+	Diagrams    string
+	DiagramsDPI int
+	// PDFEngine is the pandoc PDF engine, see pandoc.EngineNames.
+	PDFEngine string
+	// Converter is the SVG to PDF converter, see converters.Names.
+	Converter string
+	// PDFNative renders PDF diagrams directly with plantuml when it supports
+	// it, instead of converting from SVG.
+	PDFNative       bool
+	PlantUMLJar     string
+	PlantUMLVersion string
+	PlantUMLSHA256  string
+	// PlantUMLPreamble is a file included right after @startuml in every
+	// diagram, unless the document front matter names another one.
+	PlantUMLPreamble string
+	// PlantUMLTheme and PlantUMLConfig are the plantuml theme and
+	// configuration file of every diagram, unless the document front matter
+	// or the diagram macro name others.
+	PlantUMLTheme  string
+	PlantUMLConfig string
+	// Offline forbids downloading anything.
+	Offline bool
+	// Timeouts limit each external tool run, zero meaning no limit.
+	PlantUMLTimeout  time.Duration
+	ConverterTimeout time.Duration
+	PandocTimeout    time.Duration
+	// Cache keeps the rendered diagrams for later builds.
+	Cache bool
+	// KeepGoing replaces failing diagrams by placeholders instead of stopping
+	// at the first one.
+	KeepGoing bool
+	// DiagramsURL, when not empty, is the URL prefix diagrams are linked with
+	// instead of their file path.
+	DiagramsURL string
+	// DiagramsDir, when not empty, is the directory diagrams are also written
+	// to, and linked from unless DiagramsURL is given. It is needed when the
+	// output format links diagrams instead of embedding them (latex).
+	DiagramsDir string
+	// NoEmbed stops pandoc from embedding images in the output.
+	NoEmbed bool
+	// KeepTemp keeps the temporary workspace of the build for debugging.
+	KeepTemp bool
+}
+
+// Options are the settings given by the command line flags.
 type Options struct {
+	Settings
 	InputFile   string
 	OutputFile  string
-	Cache       bool
 	Verbose     bool
-	Diagrams    string
-	DiagramsDPI int
+	ErrorFormat string
 	Usage       bool
 }
 
-var options Options
+type contextKey struct{}
 
-const optionsKey = "options"
+// ConfigureFlags configures the flags of a build, returning the options they
+// set.
+func ConfigureFlags(fs *flag.FlagSet) *Options {
+	options := ConfigureToolFlags(fs)
+	fs.StringVar(&options.InputFile, "in", "", "Markdown input `file`")
+	fs.StringVar(&options.OutputFile, "out", "", "Output `file` (its extension selects the format: .pdf, .tex, .html, .epub, .docx or .odt)")
+	fs.BoolVar(&options.Cache, "cache", false, "Cache generated intermediate results")
+	fs.StringVar(&options.Diagrams, "diagrams", "", "Diagrams `format`: \"eps\", \"pdf\", \"svg\" or \"png\" (default is the best fit for the output format)")
+	fs.StringVar(&options.PlantUMLPreamble, "plantuml-preamble", "", "PlantUML `file` included right after @startuml in every diagram")
+	fs.StringVar(&options.PlantUMLTheme, "plantuml-theme", "", "PlantUML `theme` of every diagram")
+	fs.StringVar(&options.PlantUMLConfig, "plantuml-config", "", "PlantUML configuration `file` used for every diagram")
+	fs.BoolVar(&options.KeepGoing, "keep-going", false, "Replace failing diagrams by placeholders instead of stopping at the first one")
+	fs.BoolVar(&options.KeepTemp, "keep-temp", false, "Keep the temporary workspace of the build for debugging")
+	fs.StringVar(&options.ErrorFormat, "error-format", "text", "Errors `format`: \"text\" or \"json\"")
+	fs.BoolVar(&options.Usage, "help", false, "Show this help")
+	return options
+}
 
-func ConfigureFlags() {
-	flag.StringVar(&options.InputFile, "in", "", "Markdown input `file`")
-	flag.StringVar(&options.OutputFile, "out", "", "PDF output `file`")
-	flag.BoolVar(&options.Cache, "cache", false, "Cache generated intermediate results")
-	flag.BoolVar(&options.Verbose, "verbose", false, "Be verbose")
-	flag.StringVar(&options.Diagrams, "diagrams", "pdf", "Diagrams `format`: \"eps\" or \"pdf\"")
-	flag.IntVar(&options.DiagramsDPI, "resolution", 300, "Diagrams `dpi` resolution")
-	flag.BoolVar(&options.Usage, "help", false, "Show this help")
+// ConfigureToolFlags configures the flags selecting and tuning the external
+// tools, returning the options they set.
+func ConfigureToolFlags(fs *flag.FlagSet) *Options {
+	options := &Options{}
+	fs.BoolVar(&options.Verbose, "verbose", false, "Be verbose")
+	fs.StringVar(&options.PDFEngine, "pdf-engine", "xelatex", "PDF `engine`: \"xelatex\", \"lualatex\", \"pdflatex\", \"tectonic\", \"weasyprint\" or \"wkhtmltopdf\"")
+	fs.IntVar(&options.DiagramsDPI, "resolution", 300, "Diagrams `dpi` resolution")
+	fs.BoolVar(&options.PDFNative, "pdf-native", true, "Render PDF diagrams directly with plantuml when it supports it, instead of converting from SVG")
+	fs.StringVar(&options.Converter, "svg-converter", "auto", "SVG to PDF `converter`: \"inkscape\", \"rsvg-convert\", \"cairosvg\" or \"auto\" for the first one available")
+	fs.StringVar(&options.PlantUMLJar, "plantuml-jar", os.Getenv("PLANTUML_JAR"), "PlantUML jar `file` to use instead of a fetched one (default $PLANTUML_JAR)")
+	fs.StringVar(&options.PlantUMLVersion, "plantuml-version", "", "PlantUML `version` to use (default is the latest one fetched)")
+	fs.StringVar(&options.PlantUMLSHA256, "plantuml-sha256", "", "Expected SHA-256 `checksum` of the PlantUML jar")
+	fs.BoolVar(&options.Offline, "offline", false, "Never download anything")
+	fs.DurationVar(&options.PlantUMLTimeout, "timeout-plantuml", time.Minute, "Maximum `duration` of each plantuml run (0 for no limit)")
+	fs.DurationVar(&options.ConverterTimeout, "timeout-converter", time.Minute, "Maximum `duration` of each SVG to PDF converter run (0 for no limit)")
+	fs.DurationVar(&options.PandocTimeout, "timeout-pandoc", 5*time.Minute, "Maximum `duration` of the pandoc run (0 for no limit)")
+	return options
 }
 
-func WithOptions(ctx context.Context) context.Context {
-	return context.WithValue(ctx, optionsKey, &options)
+func WithOptions(ctx context.Context, opts *Options) context.Context {
+	return context.WithValue(ctx, contextKey{}, opts)
 }
 
 func Get(ctx context.Context) *Options {
-	return ctx.Value(optionsKey).(*Options)
+	return ctx.Value(contextKey{}).(*Options)
 }
@@ -0,0 +1,65 @@
+package pandoc
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+type Engine struct {
+	Name string
+	// HTML engines render PDF from pandoc's HTML output instead of LaTeX.
+	HTML bool
+	// Fonts engines can use system fonts through the mainfont and monofont
+	// variables.
+	Fonts bool
+	// MinPandoc is the first pandoc major version supporting the engine.
+	MinPandoc int
+}
+
+var engines = []Engine{
+	{Name: "xelatex", Fonts: true, MinPandoc: 1},
+	{Name: "lualatex", Fonts: true, MinPandoc: 1},
+	{Name: "pdflatex", MinPandoc: 1},
+	{Name: "tectonic", Fonts: true, MinPandoc: 2},
+	{Name: "weasyprint", HTML: true, MinPandoc: 2},
+	{Name: "wkhtmltopdf", HTML: true, MinPandoc: 2},
+}
+
+func EngineNames() []string {
+	names := make([]string, len(engines))
+	for i, e := range engines {
+		names[i] = e.Name
+	}
+	return names
+}
+
+func LookupEngine(name string) (Engine, error) {
+	for _, e := range engines {
+		if e.Name == name {
+			return e, nil
+		}
+	}
+	return Engine{}, fmt.Errorf("unknown PDF engine %q (known engines are %s)", name, strings.Join(EngineNames(), ", "))
+}
+
+// CheckEngine verifies that the named engine is known, supported by the
+// installed pandoc and available in the PATH.
+func CheckEngine(ctx context.Context, name string) (Engine, error) {
+	e, err := LookupEngine(name)
+	if err != nil {
+		return Engine{}, err
+	}
+	v, err := Version(ctx)
+	if err != nil {
+		return Engine{}, err
+	}
+	if v.Major < e.MinPandoc {
+		return Engine{}, fmt.Errorf("PDF engine %q requires pandoc %d or later (found %v)", e.Name, e.MinPandoc, v)
+	}
+	if _, err := exec.LookPath(e.Name); err != nil {
+		return Engine{}, fmt.Errorf("PDF engine %q not found: %w", e.Name, err)
+	}
+	return e, nil
+}
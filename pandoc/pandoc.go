@@ -6,23 +6,34 @@ import (
 	"io"
 	"os/exec"
 
+	"go.uber.org/zap"
+
 	"github.com/lalloni/markr/logging"
+	"github.com/lalloni/markr/options"
 	"github.com/lalloni/markr/processes"
+	"github.com/lalloni/markr/versions"
 )
 
 var pandocOptions = []string{
 	"--toc",
 	"--reference-links",
-	"--smart",
-	"--latex-engine=xelatex",
 	"--number-sections",
 	"--section-divs",
 	"--standalone",
-	"--self-contained",
-	"-f", "markdown-implicit_figures",
+}
+
+const (
+	MainFont = "Ubuntu"
+	MonoFont = "Iosevka"
+)
+
+var fontOptions = []string{
+	"-V", "mainfont=" + MainFont,
+	"-V", "monofont=" + MonoFont,
+}
+
+var latexOptions = []string{
 	"-t", "latex",
-	"-V", "mainfont=Ubuntu",
-	"-V", "monofont=Iosevka",
 	"-V", "papersize=A4",
 	"-V", "urlcolor=blue",
 	"-V", "colorlinks",
@@ -34,15 +45,87 @@ var pandocOptions = []string{
 	"-V", "include-before=\\renewcommand{\\contentsname}{Contenidos}",
 }
 
+var htmlOptions = []string{
+	"-t", "html5",
+	"-V", "lang=es",
+}
+
+// embedOptions returns the option making pandoc embed images and other
+// resources in the output.
+func embedOptions(v versions.Version) []string {
+	if v.Major < 3 {
+		return []string{"--self-contained"}
+	}
+	return []string{"--embed-resources"}
+}
+
+// versionOptions returns the options whose spelling changed between pandoc
+// major versions, selecting the PDF engine unless it is empty.
+func versionOptions(v versions.Version, engine string) ([]string, error) {
+	switch v.Major {
+	case 1:
+		args := []string{"--smart", "-f", "markdown-implicit_figures"}
+		if engine != "" {
+			args = append(args, "--latex-engine="+engine)
+		}
+		return args, nil
+	case 2, 3:
+		args := []string{"-f", "markdown+smart-implicit_figures"}
+		if engine != "" {
+			args = append(args, "--pdf-engine="+engine)
+		}
+		return args, nil
+	default:
+		return nil, fmt.Errorf("unsupported pandoc version %v (supported major versions are 1, 2 and 3)", v)
+	}
+}
+
 func RenderMarkdown(ctx context.Context, input io.Reader, file string) error {
 	log := logging.ZapLogger(ctx)
-	log.Info("rendering with pandoc")
-	cmd := exec.Command("pandoc", append(pandocOptions, "-o", file)...)
+	v, err := Version(ctx)
+	if err != nil {
+		return err
+	}
+	target, err := TargetFor(file)
+	if err != nil {
+		return err
+	}
+	var engine Engine
+	if target.Name == "pdf" {
+		engine, err = LookupEngine(options.Get(ctx).PDFEngine)
+		if err != nil {
+			return err
+		}
+	}
+	args, err := versionOptions(v, engine.Name)
+	if err != nil {
+		return err
+	}
+	args = append(args, pandocOptions...)
+	if !options.Get(ctx).NoEmbed {
+		args = append(args, embedOptions(v)...)
+	}
+	switch {
+	case target.Name == "pdf" && engine.HTML:
+		args = append(args, htmlOptions...)
+	case target.Name == "pdf" || target.Name == "latex":
+		args = append(args, latexOptions...)
+		if engine.Fonts {
+			args = append(args, fontOptions...)
+		}
+	default:
+		args = append(args, target.Options...)
+	}
+	args = append(args, "-o", file)
+	log.Info("rendering with pandoc", zap.String("target", target.Name), zap.String("engine", engine.Name))
+	ctx, cancel := processes.WithTimeout(ctx, options.Get(ctx).PandocTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "pandoc", args...)
 	logger := logging.LoggerWriter(log, "pandoc")
 	defer logger.Close()
-	err := processes.Pipe(ctx, cmd, input, logger, logger)
+	err = processes.Pipe(ctx, "pandoc", cmd, input, logger, logger)
 	if err != nil {
-		return fmt.Errorf("running pandoc: %v", err)
+		return fmt.Errorf("running pandoc: %w", err)
 	}
 	return nil
 }
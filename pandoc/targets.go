@@ -0,0 +1,82 @@
+package pandoc
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+type Target struct {
+	Name       string
+	Extensions []string
+	// Options are the pandoc options specific to the target.
+	Options []string
+	// Images are the diagram formats the target can embed, preferred first.
+	Images []string
+	// Links tells whether the output references the image files instead of
+	// embedding them.
+	Links bool
+}
+
+var targets = []Target{
+	{Name: "pdf", Extensions: []string{".pdf"}},
+	{Name: "latex", Extensions: []string{".tex", ".latex"}, Options: latexOptions, Images: []string{"pdf", "png", "eps"}, Links: true},
+	{Name: "html", Extensions: []string{".html", ".htm"}, Options: htmlOptions, Images: []string{"svg", "png"}},
+	{Name: "epub", Extensions: []string{".epub"}, Options: []string{"-t", "epub3"}, Images: []string{"svg", "png"}},
+	{Name: "docx", Extensions: []string{".docx"}, Options: []string{"-t", "docx"}, Images: []string{"png"}},
+	{Name: "odt", Extensions: []string{".odt"}, Options: []string{"-t", "odt"}, Images: []string{"png", "svg"}},
+}
+
+// TargetFor returns the target corresponding to the output file extension.
+func TargetFor(file string) (Target, error) {
+	ext := strings.ToLower(path.Ext(file))
+	var exts []string
+	for _, t := range targets {
+		for _, e := range t.Extensions {
+			if e == ext {
+				return t, nil
+			}
+		}
+		exts = append(exts, t.Extensions...)
+	}
+	return Target{}, fmt.Errorf("unsupported output file extension %q (supported extensions are %s)", ext, strings.Join(exts, ", "))
+}
+
+// LookupTarget returns the target named name.
+func LookupTarget(name string) (Target, error) {
+	var names []string
+	for _, t := range targets {
+		if t.Name == name {
+			return t, nil
+		}
+		names = append(names, t.Name)
+	}
+	return Target{}, fmt.Errorf("unsupported output format %q (supported formats are %s)", name, strings.Join(names, ", "))
+}
+
+// ImageFormats returns the diagram formats the target can embed when
+// rendered using the engine, preferred first.
+func ImageFormats(t Target, e Engine) []string {
+	if t.Name != "pdf" {
+		return t.Images
+	}
+	if e.HTML {
+		return []string{"svg", "png"}
+	}
+	return []string{"pdf", "png", "eps"}
+}
+
+// CheckImageFormat verifies the target can embed diagrams in the format when
+// rendered using the engine.
+func CheckImageFormat(t Target, e Engine, format string) error {
+	formats := ImageFormats(t, e)
+	for _, f := range formats {
+		if f == format {
+			return nil
+		}
+	}
+	if t.Name == "pdf" {
+		return fmt.Errorf("%s diagrams can't be used with PDF engine %q (use %s)", format, e.Name, strings.Join(formats, " or "))
+	}
+	return fmt.Errorf("%s diagrams can't be used in %s output (use %s)", format, t.Name, strings.Join(formats, " or "))
+}
@@ -0,0 +1,39 @@
+package pandoc
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/lalloni/markr/logging"
+	"github.com/lalloni/markr/processes"
+	"github.com/lalloni/markr/versions"
+)
+
+var detected versions.Cache
+
+// Version returns the version of the pandoc found in PATH, running
+// `pandoc --version` only until it is detected for that binary.
+func Version(ctx context.Context) (versions.Version, error) {
+	return detected.Get("pandoc", func(bin string) (versions.Version, error) {
+		return detectVersion(ctx, bin)
+	})
+}
+
+func detectVersion(ctx context.Context, bin string) (versions.Version, error) {
+	log := logging.ZapLogger(ctx)
+	out, err := processes.Output(ctx, exec.CommandContext(ctx, bin, "--version"))
+	if err != nil {
+		return versions.Version{}, fmt.Errorf("detecting pandoc version: %w", err)
+	}
+	line := strings.SplitN(string(out), "\n", 2)[0]
+	v, err := versions.Parse(line)
+	if err != nil {
+		return versions.Version{}, fmt.Errorf("parsing pandoc version: %v", err)
+	}
+	log.Info("detected pandoc", zap.Stringer("version", v))
+	return v, nil
+}
@@ -0,0 +1,39 @@
+package plantuml
+
+import (
+	"strconv"
+	"strings"
+)
+
+// SyntaxError is a diagram error reported by plantuml.
+type SyntaxError struct {
+	// Line is the index of the offending line in the diagram source, counting
+	// from 0 (the @startuml line).
+	Line    int
+	Message string
+}
+
+// ParseSyntaxError finds the syntax error plantuml reports on its standard
+// error when running in pipe mode, which looks like:
+//
+//	ERROR
+//	3
+//	Syntax Error?
+func ParseSyntaxError(stderr string) (SyntaxError, bool) {
+	lines := strings.Split(strings.Replace(stderr, "\r\n", "\n", -1), "\n")
+	for i, l := range lines {
+		if strings.TrimSpace(l) != "ERROR" || i+1 >= len(lines) {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(lines[i+1]))
+		if err != nil {
+			continue
+		}
+		e := SyntaxError{Line: n, Message: "syntax error"}
+		if i+2 < len(lines) && strings.TrimSpace(lines[i+2]) != "" {
+			e.Message = strings.TrimSpace(lines[i+2])
+		}
+		return e, true
+	}
+	return SyntaxError{}, false
+}
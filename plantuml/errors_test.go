@@ -0,0 +1,26 @@
+package plantuml
+
+import "testing"
+
+func TestParseSyntaxError(t *testing.T) {
+	tests := []struct {
+		name   string
+		stderr string
+		want   SyntaxError
+		found  bool
+	}{
+		{name: "syntax error", stderr: "ERROR\n3\nSyntax Error?\n", want: SyntaxError{Line: 3, Message: "Syntax Error?"}, found: true},
+		{name: "crlf", stderr: "ERROR\r\n0\r\nSyntax Error?\r\n", want: SyntaxError{Line: 0, Message: "Syntax Error?"}, found: true},
+		{name: "no message", stderr: "ERROR\n2\n", want: SyntaxError{Line: 2, Message: "syntax error"}, found: true},
+		{name: "after other output", stderr: "some warning\nERROR\n5\nCannot find group\n", want: SyntaxError{Line: 5, Message: "Cannot find group"}, found: true},
+		{name: "no line number", stderr: "ERROR\nsomething else\n"},
+		{name: "error last", stderr: "ERROR"},
+		{name: "empty", stderr: ""},
+	}
+	for _, tt := range tests {
+		got, found := ParseSyntaxError(tt.stderr)
+		if found != tt.found || got != tt.want {
+			t.Errorf("%s: ParseSyntaxError() = %+v, %v, want %+v, %v", tt.name, got, found, tt.want, tt.found)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package plantuml
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/lalloni/markr/logging"
+)
+
+const probeDiagram = "@startuml\nmarkr -> plantuml\n@enduml\n"
+
+// pdfSupport tells by plantuml command whether it renders PDF by itself.
+var pdfSupport struct {
+	sync.Mutex
+	probed map[string]bool
+}
+
+// SupportsPDF reports whether plantuml can render PDF by itself, which
+// depends on the jar including the Batik and FOP libraries. The check renders
+// a tiny diagram and is done only the first time it succeeds for the plantuml
+// command in use.
+func SupportsPDF(ctx context.Context) bool {
+	log := logging.ZapLogger(ctx).Sugar()
+	command, err := Command(ctx)
+	if err != nil {
+		log.Infow("plantuml can't render PDF", "error", err)
+		return false
+	}
+	key := strings.Join(command, " ")
+	pdfSupport.Lock()
+	defer pdfSupport.Unlock()
+	if supported, ok := pdfSupport.probed[key]; ok {
+		return supported
+	}
+	var pdf bytes.Buffer
+	err = Render(ctx, strings.NewReader(probeDiagram), &pdf, "pdf")
+	if err != nil {
+		log.Infow("plantuml can't render PDF", "error", err)
+		return false
+	}
+	supported := bytes.HasPrefix(pdf.Bytes(), []byte("%PDF-"))
+	if !supported {
+		log.Infow("plantuml can't render PDF", "error", "output is not a PDF document")
+	}
+	if pdfSupport.probed == nil {
+		pdfSupport.probed = map[string]bool{}
+	}
+	pdfSupport.probed[key] = supported
+	return supported
+}
@@ -2,22 +2,30 @@ package plantuml
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
-	"math/rand"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"os/exec"
-	"path"
-	"strconv"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/lalloni/markr/logging"
+	"github.com/lalloni/markr/options"
 	"github.com/lalloni/markr/processes"
 	"github.com/mitchellh/go-homedir"
 )
 
-func downloadTo(target, url string) error {
+const latestURL = "https://downloads.sourceforge.net/project/plantuml/plantuml.jar?r=https%%3A%%2F%%2Fsourceforge.net%%2Fprojects%%2Fplantuml%%2Ffiles%%2Fplantuml.jar%%2Fdownload%%3Fuse_mirror%%3Dautoselect&ts=%d&use_mirror=autoselect"
+
+const versionURL = "https://repo1.maven.org/maven2/net/sourceforge/plantuml/plantuml/%s/plantuml-%s.jar"
+
+func downloadTo(target, url, checksum string) error {
 	r, err := http.Get(url)
 	if err != nil {
 		return fmt.Errorf("executing http get: %v", err)
@@ -26,74 +34,192 @@ func downloadTo(target, url string) error {
 	if r.StatusCode != http.StatusOK {
 		return fmt.Errorf("unexpected http status %v", r.StatusCode)
 	}
-	rand.Seed(time.Now().UnixNano())
-	tmp := path.Join(os.TempDir(), strconv.Itoa(rand.Int()))
-	tmpf, err := os.Create(tmp)
+	err = os.MkdirAll(filepath.Dir(target), os.FileMode(0777))
+	if err != nil {
+		return fmt.Errorf("creating cache dir: %v", err)
+	}
+	tmpf, err := ioutil.TempFile(filepath.Dir(target), filepath.Base(target)+".*.tmp")
 	if err != nil {
 		return fmt.Errorf("creating file: %v", err)
 	}
 	defer func() {
 		tmpf.Close()
-		os.Remove(tmp)
+		os.Remove(tmpf.Name())
 	}()
-	c, err := io.Copy(tmpf, r.Body)
+	h := sha256.New()
+	c, err := io.Copy(io.MultiWriter(tmpf, h), r.Body)
 	if err != nil {
 		return fmt.Errorf("downloading: %v", err)
 	}
-	if c != r.ContentLength {
+	if r.ContentLength >= 0 && c != r.ContentLength {
 		return fmt.Errorf("downloaded %v bytes expecting %v", c, r.ContentLength)
 	}
-	if _, err := os.Stat(path.Dir(target)); err != nil {
-		if os.IsNotExist(err) {
-			err := os.MkdirAll(path.Dir(target), os.FileMode(0777))
-			if err != nil {
-				return fmt.Errorf("creating cache dir: %v", err)
-			}
-		} else {
-			return fmt.Errorf("looking for cache dir: %v", err)
+	if checksum != "" {
+		if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, checksum) {
+			return fmt.Errorf("downloaded file has SHA-256 checksum %s expecting %s", sum, checksum)
 		}
 	}
-	ff, err := os.Create(target)
+	err = tmpf.Close()
 	if err != nil {
-		return fmt.Errorf("creating file: %v", err)
+		return fmt.Errorf("writing file: %v", err)
+	}
+	err = os.Rename(tmpf.Name(), target)
+	if err != nil {
+		return fmt.Errorf("moving to final path: %v", err)
 	}
-	defer ff.Close()
-	tmpf.Seek(0, 0)
-	cc, err := io.Copy(ff, tmpf)
+	return nil
+}
+
+// verified are the jars whose checksum was verified, by file and checksum,
+// along with their modification time and size then.
+var verified struct {
+	sync.Mutex
+	jars map[[2]string]os.FileInfo
+}
+
+// verifyJar verifies the checksum of the jar unless it was already verified
+// and it is unchanged since.
+func verifyJar(file, checksum string) error {
+	info, err := os.Stat(file)
 	if err != nil {
-		return fmt.Errorf("copying to final path: %v", err)
+		return fmt.Errorf("checking file: %v", err)
 	}
-	if cc != c {
-		return fmt.Errorf("copied %v bytes expecting %v", cc, c)
+	key := [2]string{file, strings.ToLower(checksum)}
+	verified.Lock()
+	defer verified.Unlock()
+	if v, ok := verified.jars[key]; ok && v.ModTime().Equal(info.ModTime()) && v.Size() == info.Size() {
+		return nil
 	}
+	err = verifyChecksum(file, checksum)
+	if err != nil {
+		return err
+	}
+	if verified.jars == nil {
+		verified.jars = map[[2]string]os.FileInfo{}
+	}
+	verified.jars[key] = info
 	return nil
 }
 
-func Render(ctx context.Context, input io.Reader, output io.Writer, format string) error {
-	log := logging.ZapLogger(ctx)
-	p, err := homedir.Expand("~/.cache/markr/plantuml.jar")
+func verifyChecksum(file, checksum string) error {
+	f, err := os.Open(file)
 	if err != nil {
-		return fmt.Errorf("building plantuml.jar cached location: %v", err)
+		return fmt.Errorf("opening file: %v", err)
 	}
-	_, err = os.Stat(p)
+	defer f.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, f)
 	if err != nil {
-		if os.IsNotExist(err) {
-			err := downloadTo(p, fmt.Sprintf("https://downloads.sourceforge.net/project/plantuml/plantuml.jar?r=https%%3A%%2F%%2Fsourceforge.net%%2Fprojects%%2Fplantuml%%2Ffiles%%2Fplantuml.jar%%2Fdownload%%3Fuse_mirror%%3Dautoselect&ts=%d&use_mirror=autoselect", time.Now().Unix()))
-			if err != nil {
-				return fmt.Errorf("downloading plantuml.jar to %q: %v", p, err)
+		return fmt.Errorf("reading file: %v", err)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, checksum) {
+		return fmt.Errorf("file %q has SHA-256 checksum %s expecting %s", file, sum, checksum)
+	}
+	return nil
+}
+
+// cachedJar returns the location of the downloaded plantuml.jar for the
+// version, which is the latest one when version is empty.
+func cachedJar(version string) (string, error) {
+	name := "plantuml.jar"
+	if version != "" {
+		name = "plantuml-" + version + ".jar"
+	}
+	p, err := homedir.Expand("~/.cache/markr/" + name)
+	if err != nil {
+		return "", fmt.Errorf("building %s cached location: %v", name, err)
+	}
+	return p, nil
+}
+
+// Command returns the command used to run plantuml, which is in order of
+// preference: the jar given in the options, the jar previously fetched to the
+// cache and the system plantuml launcher (unless a version or checksum is
+// pinned).
+func Command(ctx context.Context) ([]string, error) {
+	opts := options.Get(ctx)
+	if opts.PlantUMLJar != "" {
+		if _, err := os.Stat(opts.PlantUMLJar); err != nil {
+			return nil, fmt.Errorf("checking plantuml jar: %v", err)
+		}
+		if opts.PlantUMLSHA256 != "" {
+			if err := verifyJar(opts.PlantUMLJar, opts.PlantUMLSHA256); err != nil {
+				return nil, fmt.Errorf("verifying plantuml jar: %v", err)
 			}
-		} else {
-			return fmt.Errorf("checking plantuml.jar cached existence: %v", err)
 		}
+		return []string{"java", "-jar", opts.PlantUMLJar}, nil
+	}
+	p, err := cachedJar(opts.PlantUMLVersion)
+	if err != nil {
+		return nil, err
+	}
+	_, err = os.Stat(p)
+	if err == nil {
+		if opts.PlantUMLSHA256 != "" {
+			if err := verifyJar(p, opts.PlantUMLSHA256); err != nil {
+				return nil, fmt.Errorf("verifying cached plantuml jar: %v", err)
+			}
+		}
+		return []string{"java", "-jar", p}, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("checking plantuml.jar cached existence: %v", err)
+	}
+	if opts.PlantUMLVersion == "" && opts.PlantUMLSHA256 == "" {
+		if launcher, err := exec.LookPath("plantuml"); err == nil {
+			return []string{launcher}, nil
+		}
+	}
+	fetch := "markr tools fetch plantuml"
+	if opts.PlantUMLVersion != "" {
+		fetch += " -version " + opts.PlantUMLVersion
+	}
+	return nil, fmt.Errorf("plantuml not found at %q nor in PATH (run %q, use -plantuml-jar or set PLANTUML_JAR): %w", p, fetch, exec.ErrNotFound)
+}
+
+// Fetch downloads the plantuml jar for the version (the latest one when empty)
+// to the cache, verifying its checksum when not empty, and returns its location.
+func Fetch(ctx context.Context, version, checksum string) (string, error) {
+	log := logging.ZapLogger(ctx).Sugar()
+	if options.Get(ctx).Offline {
+		return "", fmt.Errorf("downloading plantuml is not allowed when offline")
+	}
+	p, err := cachedJar(version)
+	if err != nil {
+		return "", err
+	}
+	url := fmt.Sprintf(latestURL, time.Now().Unix())
+	if version != "" {
+		url = fmt.Sprintf(versionURL, version, version)
+	}
+	if checksum == "" {
+		log.Warnw("downloading plantuml without verifying its checksum (use -sha256 to verify it)", "url", url)
+	}
+	log.Infow("downloading plantuml", "url", url, "file", p)
+	err = downloadTo(p, url, checksum)
+	if err != nil {
+		return "", fmt.Errorf("downloading plantuml.jar to %q: %v", p, err)
+	}
+	return p, nil
+}
+
+func Render(ctx context.Context, input io.Reader, output io.Writer, format string, args ...string) error {
+	log := logging.ZapLogger(ctx)
+	command, err := Command(ctx)
+	if err != nil {
+		return err
 	}
-	log.Sugar().Infow("using plantuml from " + p)
+	log.Sugar().Infow("using plantuml", "command", command)
 	log.Sugar().Infow("rendering with plantuml", "format", format)
 	logger := logging.LoggerWriter(log, "plantuml")
 	defer logger.Close()
-	cmd := exec.Command("java", "-jar", p, "-v", "-pipe", "-t"+format)
-	err = processes.Pipe(ctx, cmd, input, output, logger)
+	args = append(append(command[1:], "-v", "-pipe", "-t"+format), args...)
+	ctx, cancel := processes.WithTimeout(ctx, options.Get(ctx).PlantUMLTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, command[0], args...)
+	err = processes.Pipe(ctx, "plantuml", cmd, input, output, logger)
 	if err != nil {
-		return fmt.Errorf("running plantuml: %v", err)
+		return fmt.Errorf("running plantuml: %w", err)
 	}
 	return nil
 }
@@ -0,0 +1,64 @@
+package processes
+
+import (
+	"bytes"
+	"strings"
+)
+
+// ExternalToolError describes the failure of an external tool run.
+type ExternalToolError struct {
+	Tool string
+	Args []string
+	// ExitCode is -1 when the tool didn't exit by itself.
+	ExitCode int
+	// Stderr is the tail of what the tool wrote to its standard error.
+	Stderr string
+	Err    error
+}
+
+func (e *ExternalToolError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExternalToolError) Unwrap() error {
+	return e.Err
+}
+
+// StderrLines returns the non blank lines of the standard error tail.
+func (e *ExternalToolError) StderrLines() []string {
+	var lines []string
+	for _, l := range strings.Split(e.Stderr, "\n") {
+		if strings.TrimSpace(l) != "" {
+			lines = append(lines, strings.TrimRight(l, "\r"))
+		}
+	}
+	return lines
+}
+
+const stderrTailSize = 4096
+
+// tail keeps the last lines written to it, up to stderrTailSize bytes.
+type tail struct {
+	buf       []byte
+	truncated bool
+}
+
+func (t *tail) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > stderrTailSize {
+		t.buf = t.buf[len(t.buf)-stderrTailSize:]
+		t.truncated = true
+	}
+	return len(p), nil
+}
+
+func (t *tail) String() string {
+	b := t.buf
+	if t.truncated {
+		// drop the partial first line
+		if i := bytes.IndexByte(b, '\n'); i >= 0 {
+			b = b[i+1:]
+		}
+	}
+	return string(b)
+}
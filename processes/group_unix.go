@@ -0,0 +1,22 @@
+//go:build !windows
+// +build !windows
+
+package processes
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup makes the command start a new process group, so it can be
+// killed along with its children.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
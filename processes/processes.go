@@ -5,46 +5,102 @@ import (
 	"fmt"
 	"io"
 	"os/exec"
+	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/lalloni/markr/logging"
 )
 
-func Pipe(ctx context.Context, cmd *exec.Cmd, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+// WithTimeout returns a context cancelled after the timeout, or just
+// cancellable when the timeout is zero.
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// Pipe runs the command connected to the given streams. The command should be
+// created with exec.CommandContext and the same context, which when done makes
+// Pipe kill the command along with every process it started. When the tool
+// fails the returned error is an *ExternalToolError.
+func Pipe(ctx context.Context, tool string, cmd *exec.Cmd, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
 
 	log := logging.ZapLogger(ctx)
 
 	log.Info("running", zap.Strings("command", cmd.Args))
 
-	stdinPipe, err := cmd.StdinPipe()
+	var errtail tail
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = io.MultiWriter(stderr, &errtail)
+	setProcessGroup(cmd)
+
+	err := cmd.Start()
 	if err != nil {
-		return fmt.Errorf("connecting stdin pipe: %v", err)
+		return fmt.Errorf("starting command: %w", err)
 	}
-	defer stdinPipe.Close()
+
+	done := make(chan struct{})
+	defer close(done)
 	go func() {
-		io.Copy(stdinPipe, stdin)
-		stdinPipe.Close()
+		select {
+		case <-ctx.Done():
+			log.Info("killing", zap.Strings("command", cmd.Args), zap.Error(ctx.Err()))
+			killProcessGroup(cmd)
+		case <-done:
+		}
 	}()
 
-	stdoutPipe, err := cmd.StdoutPipe()
-	if err != nil {
-		return fmt.Errorf("connecting stdout pipe: %v", err)
+	err = cmd.Wait()
+	if err == nil && ctx.Err() == nil {
+		return nil
 	}
-	defer stdoutPipe.Close()
-	go io.Copy(stdout, stdoutPipe)
 
-	stderrPipe, err := cmd.StderrPipe()
+	terr := &ExternalToolError{
+		Tool:     tool,
+		Args:     cmd.Args,
+		ExitCode: -1,
+		Stderr:   errtail.String(),
+		Err:      err,
+	}
+	if cmd.ProcessState != nil && cmd.ProcessState.Exited() {
+		terr.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		terr.Err = fmt.Errorf("timed out")
+	case context.Canceled:
+		terr.Err = fmt.Errorf("cancelled")
+	}
+	return terr
+}
+
+func Output(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+
+	log := logging.ZapLogger(ctx)
+
+	log.Info("running", zap.Strings("command", cmd.Args))
+
+	out, err := cmd.Output()
 	if err != nil {
-		return fmt.Errorf("connecting stderr pipe: %v", err)
+		return nil, fmt.Errorf("running command: %w", err)
 	}
-	defer stderrPipe.Close()
-	go io.Copy(stderr, stderrPipe)
 
-	err = cmd.Run()
+	return out, nil
+}
+
+func CombinedOutput(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+
+	log := logging.ZapLogger(ctx)
+
+	log.Info("running", zap.Strings("command", cmd.Args))
+
+	out, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("running command: %v", err)
+		return out, fmt.Errorf("running command: %w", err)
 	}
 
-	return nil
+	return out, nil
 }
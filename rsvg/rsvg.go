@@ -0,0 +1,29 @@
+package rsvg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+
+	"github.com/lalloni/markr/logging"
+	"github.com/lalloni/markr/options"
+	"github.com/lalloni/markr/processes"
+)
+
+func ConvertToPDF(ctx context.Context, input io.Reader, output io.Writer) error {
+	log := logging.ZapLogger(ctx)
+	log.Info("rendering with rsvg-convert")
+	logger := logging.LoggerWriter(log, "rsvg-convert")
+	defer logger.Close()
+	dpi := strconv.Itoa(options.Get(ctx).DiagramsDPI)
+	ctx, cancel := processes.WithTimeout(ctx, options.Get(ctx).ConverterTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "rsvg-convert", "--format", "pdf", "--dpi-x", dpi, "--dpi-y", dpi)
+	err := processes.Pipe(ctx, "rsvg-convert", cmd, input, output, logger)
+	if err != nil {
+		return fmt.Errorf("rendering with rsvg-convert: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lalloni/markr/builder"
+	"github.com/lalloni/markr/logging"
+	"github.com/lalloni/markr/options"
+	"github.com/lalloni/markr/watcher"
+)
+
+const reloadScript = `<script>new EventSource("/events").onmessage = function() { location.reload(); };</script>`
+
+const errorPage = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>markr: build failed</title></head>
+<body><pre>%s</pre>%s</body></html>
+`
+
+// failureBanner shows the errors of a build which still rendered the document,
+// like the failed diagrams when keeping going.
+const failureBanner = `<pre style="border: 2px solid #c00; padding: 1em; white-space: pre-wrap">%s</pre>`
+
+var diagramPattern = regexp.MustCompile(`^[0-9a-f]{40}\.(svg|png)$`)
+
+// preview serves the last rendered document and notifies browsers when a new
+// one is available.
+type preview struct {
+	root http.Handler
+
+	mu       sync.Mutex
+	document []byte
+	failure  string
+	clients  map[chan struct{}]bool
+}
+
+func (p *preview) rendered(document []byte, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.document = document
+	p.failure = ""
+	if err != nil {
+		p.failure = asBuildError(err).Text()
+	}
+	for c := range p.clients {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (p *preview) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/":
+		p.serveDocument(w, r)
+	case r.URL.Path == "/events":
+		p.serveEvents(w, r)
+	case strings.HasPrefix(r.URL.Path, "/diagrams/"):
+		p.serveDiagram(w, r)
+	default:
+		p.root.ServeHTTP(w, r)
+	}
+}
+
+func (p *preview) serveDocument(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	p.mu.Lock()
+	failure := p.failure
+	content := append([]byte(nil), p.document...)
+	p.mu.Unlock()
+	if failure != "" && len(content) == 0 {
+		fmt.Fprintf(w, errorPage, html.EscapeString(failure), reloadScript)
+		return
+	}
+	if failure != "" {
+		banner := []byte(fmt.Sprintf(failureBanner, html.EscapeString(failure)))
+		if i := bytes.Index(content, []byte("<body")); i >= 0 && bytes.IndexByte(content[i:], '>') >= 0 {
+			i += bytes.IndexByte(content[i:], '>') + 1
+			content = append(content[:i:i], append(banner, content[i:]...)...)
+		} else {
+			content = append(banner, content...)
+		}
+	}
+	if i := bytes.LastIndex(content, []byte("</body>")); i >= 0 {
+		content = append(content[:i:i], append([]byte(reloadScript), content[i:]...)...)
+	} else {
+		content = append(content, reloadScript...)
+	}
+	w.Write(content)
+}
+
+func (p *preview) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	c := make(chan struct{}, 1)
+	p.mu.Lock()
+	p.clients[c] = true
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.clients, c)
+		p.mu.Unlock()
+	}()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-c:
+			fmt.Fprint(w, "data: reload\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// serveDiagram serves the cached diagram file by the checksum of its source.
+func (p *preview) serveDiagram(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/diagrams/")
+	if !diagramPattern.MatchString(name) {
+		http.NotFound(w, r)
+		return
+	}
+	ext := filepath.Ext(name)
+	file, err := builder.DiagramFile(strings.TrimSuffix(name, ext), ext[1:])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// diagrams are named by content, so they never change
+	w.Header().Set("Cache-Control", "max-age=31536000, immutable")
+	http.ServeFile(w, r, file)
+}
+
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("markr serve", flag.ContinueOnError)
+	opts := options.ConfigureFlags(fs)
+	addr := fs.String("addr", "localhost:8080", "Listen `address`")
+	debounce := fs.Duration("debounce", 300*time.Millisecond, "Quiet `duration` to wait for after a change before rebuilding")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	ctx := options.WithOptions(context.Background(), opts)
+
+	if opts.Usage {
+		fs.Usage()
+		return exitOK
+	}
+
+	if opts.OutputFile != "" {
+		fmt.Fprintln(os.Stderr, "markr serve: -out is not used, the document is rendered as HTML and served")
+		return exitUsage
+	}
+	if err := checkOptions(opts, false); err != nil {
+		fmt.Fprintf(os.Stderr, "markr serve: %v\n", err)
+		fs.Usage()
+		return exitUsage
+	}
+
+	// diagrams are served from the cache
+	opts.Cache = true
+	opts.DiagramsURL = "/diagrams/"
+	opts.NoEmbed = true
+
+	logger, err := newLogger(opts.Verbose)
+	if err != nil {
+		panic(err)
+	}
+	defer logger.Sync()
+	ctx = logging.WithZapLogger(ctx, logger)
+
+	ctx, cancel := interruptible(ctx)
+	defer cancel()
+
+	p := &preview{
+		root:    http.FileServer(http.Dir(filepath.Dir(opts.InputFile))),
+		clients: make(map[chan struct{}]bool),
+	}
+
+	cfg := config(opts, logger)
+	cfg.Format = "html"
+	var document []byte
+	build := func(ctx context.Context) (builder.Result, error) {
+		var out bytes.Buffer
+		result, err := buildInput(ctx, cfg, &out)
+		document = out.Bytes()
+		return result, err
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return report(builder.NewError(builder.Failure, "listening", err), opts.ErrorFormat)
+	}
+	server := &http.Server{Handler: p}
+	go server.Serve(listener)
+	defer server.Close()
+	fmt.Fprintf(os.Stderr, "serving %s at http://%s/\n", opts.InputFile, listener.Addr())
+
+	w, err := watcher.New([]string{opts.InputFile})
+	if err != nil {
+		return report(builder.NewError(builder.Failure, "watching files", err), opts.ErrorFormat)
+	}
+	defer w.Close()
+
+	for {
+		result, err := rebuild(ctx, "preview", build)
+		if ctx.Err() != nil {
+			return exitOK
+		}
+		p.rendered(document, err)
+		err = wait(ctx, w, result.Dependencies, *debounce)
+		if err != nil {
+			return report(builder.NewError(builder.Failure, "watching files", err), opts.ErrorFormat)
+		}
+		if ctx.Err() != nil {
+			return exitOK
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package sourcemap
+
+import (
+	"fmt"
+)
+
+// Location is a line in a source file.
+type Location struct {
+	File string
+	Line int
+}
+
+func (l Location) String() string {
+	return fmt.Sprintf("%s:%d", l.File, l.Line)
+}
+
+// Map maps the lines of a generated text back to the source lines they come
+// from.
+type Map struct {
+	locations []Location
+}
+
+// Add records the source location of the next generated line.
+func (m *Map) Add(file string, line int) {
+	m.locations = append(m.locations, Location{File: file, Line: line})
+}
+
+// Lookup returns the source location of the generated line, counting from 1.
+func (m *Map) Lookup(line int) (Location, bool) {
+	if line < 1 || line > len(m.locations) {
+		return Location{}, false
+	}
+	return m.locations[line-1], true
+}
+
+// Len returns the number of generated lines recorded.
+func (m *Map) Len() int {
+	return len(m.locations)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lalloni/markr/logging"
+	"github.com/lalloni/markr/options"
+	"github.com/lalloni/markr/plantuml"
+	"github.com/lalloni/markr/tools"
+)
+
+const toolsUsage = `usage: markr tools <command> [flags]
+
+commands:
+  status                   show the external tools found, their versions and whether they are usable
+  fetch plantuml [flags]   download the plantuml jar to the cache
+  update                   download the latest (or pinned) plantuml jar and show the tools status
+`
+
+func runTools(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, toolsUsage)
+		return exitUsage
+	}
+	command, args := args[0], args[1:]
+	fs := flag.NewFlagSet("markr tools "+command, flag.ContinueOnError)
+	opts := options.ConfigureToolFlags(fs)
+	asJSON := fs.Bool("json", false, "Write machine-readable JSON output")
+	var tool, version, checksum string
+	if command == "fetch" {
+		fs.StringVar(&version, "version", "", "PlantUML `version` to fetch (default is -plantuml-version or the latest one)")
+		fs.StringVar(&checksum, "sha256", "", "Expected SHA-256 `checksum` of the downloaded jar (default is -plantuml-sha256)")
+		if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+			tool, args = args[0], args[1:]
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if tool == "" {
+		tool = fs.Arg(0)
+	}
+
+	ctx := options.WithOptions(context.Background(), opts)
+	logger, err := newLogger(opts.Verbose)
+	if err != nil {
+		panic(err)
+	}
+	defer logger.Sync()
+	log := logger.Sugar()
+	ctx = logging.WithZapLogger(ctx, logger)
+
+	ctx, cancel := interruptible(ctx)
+	defer cancel()
+
+	switch command {
+	case "status":
+		return printTools(ctx, *asJSON)
+	case "fetch":
+		if tool != "plantuml" {
+			fmt.Fprintf(os.Stderr, "markr tools fetch: can only fetch plantuml, other tools must be installed with the system package manager\n")
+			return exitUsage
+		}
+		if version == "" {
+			version = opts.PlantUMLVersion
+		}
+		if checksum == "" {
+			checksum = opts.PlantUMLSHA256
+		}
+		p, err := plantuml.Fetch(ctx, version, checksum)
+		if err != nil {
+			log.Errorw("fetching plantuml", "error", err)
+			return exitFailure
+		}
+		opts.PlantUMLJar = p
+		return printTools(ctx, *asJSON, "plantuml")
+	case "update":
+		_, err := plantuml.Fetch(ctx, opts.PlantUMLVersion, opts.PlantUMLSHA256)
+		if err != nil {
+			log.Errorw("updating plantuml", "error", err)
+			return exitFailure
+		}
+		return printTools(ctx, *asJSON)
+	default:
+		fmt.Fprintf(os.Stderr, "markr tools: unknown command %q\n\n%s", command, toolsUsage)
+		return exitUsage
+	}
+}
+
+// printTools prints the status of the named tools (or every known tool) and
+// returns the exit status, which is exitToolMissing when a required tool is
+// not usable.
+func printTools(ctx context.Context, asJSON bool, names ...string) int {
+	ts, err := tools.Detect(ctx, names...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if asJSON {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		e.Encode(ts)
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "TOOL\tSTATUS\tVERSION\tMINIMUM\tPATH\tPURPOSE")
+		for _, t := range ts {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", t.Name, toolStatus(t), t.Version, t.Minimum, t.Path, t.Purpose)
+		}
+		w.Flush()
+		for _, t := range ts {
+			if t.Problem != "" && (t.Required || t.Found) {
+				fmt.Printf("%s: %s\n", t.Name, t.Problem)
+			}
+		}
+	}
+	if !tools.Usable(ts) {
+		return exitToolMissing
+	}
+	return exitOK
+}
+
+func toolStatus(t tools.Tool) string {
+	switch {
+	case t.OK:
+		return "ok"
+	case !t.Required && !t.Found:
+		return "absent"
+	case !t.Found:
+		return "missing"
+	default:
+		return "unusable"
+	}
+}
@@ -0,0 +1,244 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/lalloni/markr/converters"
+	"github.com/lalloni/markr/options"
+	"github.com/lalloni/markr/plantuml"
+	"github.com/lalloni/markr/processes"
+	"github.com/lalloni/markr/versions"
+)
+
+type Tool struct {
+	Name     string `json:"name"`
+	Purpose  string `json:"purpose"`
+	Required bool   `json:"required"`
+	Found    bool   `json:"found"`
+	OK       bool   `json:"ok"`
+	Path     string `json:"path,omitempty"`
+	Version  string `json:"version,omitempty"`
+	Minimum  string `json:"minimum,omitempty"`
+	Problem  string `json:"problem,omitempty"`
+}
+
+type probe struct {
+	name    string
+	purpose string
+	// command returns the command running the tool, which is the tool name
+	// when nil.
+	command func(context.Context) ([]string, error)
+	// args are the arguments making the tool print its version.
+	args []string
+	// line is the prefix of the output line containing the version, which is
+	// the first line when empty.
+	line    string
+	minimum string
+	// check verifies the detected version when not nil.
+	check    func(versions.Version) error
+	required func(*options.Options) bool
+}
+
+func always(*options.Options) bool {
+	return true
+}
+
+func engine(name string) func(*options.Options) bool {
+	return func(opts *options.Options) bool {
+		return opts.PDFEngine == name
+	}
+}
+
+func converter(name string) func(*options.Options) bool {
+	return func(opts *options.Options) bool {
+		return opts.Converter == name
+	}
+}
+
+func minimum(min versions.Version) func(versions.Version) error {
+	return func(v versions.Version) error {
+		if v.Less(min) {
+			return fmt.Errorf("version %v is older than the minimum %v", v, min)
+		}
+		return nil
+	}
+}
+
+var probes = []probe{
+	{
+		name: "java", purpose: "running plantuml", args: []string{"-version"}, minimum: "8", required: always,
+		check: func(v versions.Version) error {
+			if v.Major == 1 {
+				// versions up to 8 are numbered 1.x
+				v = versions.Version{Major: v.Minor, Minor: v.Patch}
+			}
+			return minimum(versions.Version{Major: 8})(v)
+		},
+	},
+	{name: "plantuml", purpose: "rendering diagrams", command: plantuml.Command, args: []string{"-version"}, line: "PlantUML version", required: always},
+	{
+		name: "pandoc", purpose: "rendering documents", args: []string{"--version"}, minimum: "1", required: always,
+		check: func(v versions.Version) error {
+			if v.Major < 1 || v.Major > 3 {
+				return fmt.Errorf("version %v is not supported (supported major versions are 1, 2 and 3)", v)
+			}
+			return nil
+		},
+	},
+	{name: "xelatex", purpose: "PDF engine", args: []string{"--version"}, required: engine("xelatex")},
+	{name: "lualatex", purpose: "PDF engine", args: []string{"--version"}, required: engine("lualatex")},
+	{name: "pdflatex", purpose: "PDF engine", args: []string{"--version"}, required: engine("pdflatex")},
+	{name: "tectonic", purpose: "PDF engine", args: []string{"--version"}, required: engine("tectonic")},
+	{name: "weasyprint", purpose: "PDF engine", args: []string{"--version"}, required: engine("weasyprint")},
+	{name: "wkhtmltopdf", purpose: "PDF engine", args: []string{"--version"}, required: engine("wkhtmltopdf")},
+	{
+		name: "inkscape", purpose: "converting SVG to PDF", args: []string{"--version"}, line: "Inkscape ", minimum: "0.92", required: converter("inkscape"),
+		check: minimum(versions.Version{Major: 0, Minor: 92}),
+	},
+	{name: "rsvg-convert", purpose: "converting SVG to PDF", args: []string{"--version"}, required: converter("rsvg-convert")},
+	{name: "cairosvg", purpose: "converting SVG to PDF", args: []string{"--version"}, required: converter("cairosvg")},
+}
+
+// Names returns the names of the known tools.
+func Names() []string {
+	names := make([]string, len(probes))
+	for i, p := range probes {
+		names[i] = p.name
+	}
+	return names
+}
+
+// Detect returns the status of the named tools, or of every known tool when
+// no names are given.
+func Detect(ctx context.Context, names ...string) ([]Tool, error) {
+	var ps []probe
+	if len(names) == 0 {
+		ps = probes
+	}
+	for _, name := range names {
+		found := false
+		for _, p := range probes {
+			if p.name == name {
+				ps = append(ps, p)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown tool %q (known tools are %s)", name, strings.Join(Names(), ", "))
+		}
+	}
+	ts := make([]Tool, len(ps))
+	for i, p := range ps {
+		ts[i] = detect(ctx, p)
+	}
+	if len(names) == 0 && options.Get(ctx).Converter == converters.Auto {
+		if t, ok := anyConverter(ctx, ts); !ok {
+			ts = append(ts, t)
+		}
+	}
+	return ts, nil
+}
+
+// anyConverter tells whether some SVG to PDF converter is usable among the
+// detected tools, or else whether plantuml renders PDF by itself, returning
+// the tool describing the problem when neither is.
+func anyConverter(ctx context.Context, ts []Tool) (Tool, bool) {
+	for _, t := range ts {
+		if t.OK && contains(converters.Names(), t.Name) {
+			return Tool{}, true
+		}
+	}
+	if options.Get(ctx).PDFNative && plantuml.SupportsPDF(ctx) {
+		return Tool{}, true
+	}
+	return Tool{
+		Name:     "svg-converter",
+		Purpose:  "converting SVG to PDF",
+		Required: true,
+		Problem:  fmt.Sprintf("none of %s is usable and plantuml can't render PDF by itself", strings.Join(converters.Names(), ", ")),
+	}, false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func detect(ctx context.Context, p probe) Tool {
+	t := Tool{
+		Name:     p.name,
+		Purpose:  p.purpose,
+		Required: p.required(options.Get(ctx)),
+		Minimum:  p.minimum,
+	}
+	command := []string{p.name}
+	if p.command != nil {
+		c, err := p.command(ctx)
+		if err != nil {
+			t.Problem = err.Error()
+			return t
+		}
+		command = c
+	}
+	path, err := exec.LookPath(command[0])
+	if err != nil {
+		t.Problem = "not found in PATH"
+		return t
+	}
+	t.Found = true
+	t.Path = path
+	if len(command) > 1 {
+		t.Path = command[len(command)-1]
+	}
+	out, err := processes.CombinedOutput(ctx, exec.CommandContext(ctx, command[0], append(command[1:], p.args...)...))
+	if err != nil {
+		t.Problem = fmt.Sprintf("detecting version: %v", err)
+		return t
+	}
+	line := versionLine(string(out), p.line)
+	v, err := versions.Parse(line)
+	if err != nil {
+		t.Problem = fmt.Sprintf("detecting version: %v", err)
+		return t
+	}
+	t.Version = v.String()
+	if p.check != nil {
+		if err := p.check(v); err != nil {
+			t.Problem = err.Error()
+			return t
+		}
+	}
+	t.OK = true
+	return t
+}
+
+func versionLine(out, prefix string) string {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if prefix == "" {
+		return lines[0]
+	}
+	for _, l := range lines {
+		if strings.HasPrefix(l, prefix) {
+			return l
+		}
+	}
+	return lines[0]
+}
+
+// Usable reports whether every required tool is usable.
+func Usable(ts []Tool) bool {
+	for _, t := range ts {
+		if t.Required && !t.OK {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,37 @@
+package versions
+
+import (
+	"fmt"
+	"os/exec"
+	"sync"
+)
+
+// Cache keeps the versions of tools by binary path, so that each one is
+// detected only until it succeeds.
+type Cache struct {
+	mu    sync.Mutex
+	found map[string]Version
+}
+
+// Get returns the version of the tool named name found in PATH, which detect
+// returns given its binary path when it wasn't detected yet.
+func (c *Cache) Get(name string, detect func(bin string) (Version, error)) (Version, error) {
+	bin, err := exec.LookPath(name)
+	if err != nil {
+		return Version{}, fmt.Errorf("detecting %s version: %w", name, err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if v, ok := c.found[bin]; ok {
+		return v, nil
+	}
+	v, err := detect(bin)
+	if err != nil {
+		return Version{}, err
+	}
+	if c.found == nil {
+		c.found = map[string]Version{}
+	}
+	c.found[bin] = v
+	return v, nil
+}
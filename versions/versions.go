@@ -0,0 +1,48 @@
+package versions
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+var pattern = regexp.MustCompile(`(\d+)(?:\.(\d+))?(?:\.(\d+))?`)
+
+func Parse(s string) (Version, error) {
+	m := pattern.FindStringSubmatch(s)
+	if m == nil {
+		return Version{}, fmt.Errorf("no version number found in %q", s)
+	}
+	var v Version
+	for i, p := range []*int{&v.Major, &v.Minor, &v.Patch} {
+		if m[i+1] == "" {
+			break
+		}
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return Version{}, fmt.Errorf("parsing version number %q: %v", m[0], err)
+		}
+		*p = n
+	}
+	return v, nil
+}
+
+func (v Version) Less(o Version) bool {
+	if v.Major != o.Major {
+		return v.Major < o.Major
+	}
+	if v.Minor != o.Minor {
+		return v.Minor < o.Minor
+	}
+	return v.Patch < o.Patch
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
@@ -0,0 +1,49 @@
+package versions
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Version
+		wantErr bool
+	}{
+		{in: "pandoc 2.9.2.1", want: Version{2, 9, 2}},
+		{in: "Inkscape 1.0 (4035a4fb49, 2020-05-01)", want: Version{1, 0, 0}},
+		{in: `openjdk version "11.0.7" 2020-04-14`, want: Version{11, 0, 7}},
+		{in: `java version "1.8.0_252"`, want: Version{1, 8, 0}},
+		{in: "PlantUML version 1.2020.15 (Sun Jun 28 2020)", want: Version{1, 2020, 15}},
+		{in: "3", want: Version{3, 0, 0}},
+		{in: "no version here", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLess(t *testing.T) {
+	tests := []struct {
+		a, b Version
+		want bool
+	}{
+		{Version{1, 0, 0}, Version{2, 0, 0}, true},
+		{Version{2, 0, 0}, Version{1, 9, 9}, false},
+		{Version{0, 91, 0}, Version{0, 92, 0}, true},
+		{Version{0, 92, 1}, Version{0, 92, 0}, false},
+		{Version{1, 2, 3}, Version{1, 2, 4}, true},
+		{Version{1, 2, 3}, Version{1, 2, 3}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Less(tt.b); got != tt.want {
+			t.Errorf("%v.Less(%v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
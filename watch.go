@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lalloni/markr/builder"
+	"github.com/lalloni/markr/logging"
+	"github.com/lalloni/markr/options"
+	"github.com/lalloni/markr/watcher"
+)
+
+func runWatch(args []string) int {
+	fs := flag.NewFlagSet("markr watch", flag.ContinueOnError)
+	opts := options.ConfigureFlags(fs)
+	debounce := fs.Duration("debounce", 300*time.Millisecond, "Quiet `duration` to wait for after a change before rebuilding")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	ctx := options.WithOptions(context.Background(), opts)
+
+	if opts.Usage {
+		fs.Usage()
+		return exitOK
+	}
+
+	if err := checkOptions(opts, true); err != nil {
+		fmt.Fprintf(os.Stderr, "markr watch: %v\n", err)
+		fs.Usage()
+		return exitUsage
+	}
+
+	// only changed diagrams get rendered again
+	opts.Cache = true
+
+	logger, err := newLogger(opts.Verbose)
+	if err != nil {
+		panic(err)
+	}
+	defer logger.Sync()
+	ctx = logging.WithZapLogger(ctx, logger)
+
+	ctx, cancel := interruptible(ctx)
+	defer cancel()
+
+	// watching before building keeps the changes saved during the builds
+	w, err := watcher.New([]string{opts.InputFile})
+	if err != nil {
+		return report(builder.NewError(builder.Failure, "watching files", err), opts.ErrorFormat)
+	}
+	defer w.Close()
+
+	for {
+		result, err := rebuild(ctx, opts.OutputFile, build)
+		if ctx.Err() != nil {
+			return exitOK
+		}
+		err = wait(ctx, w, result.Dependencies, *debounce)
+		if err != nil {
+			return report(builder.NewError(builder.Failure, "watching files", err), opts.ErrorFormat)
+		}
+		if ctx.Err() != nil {
+			return exitOK
+		}
+	}
+}
+
+// rebuild builds the document named name printing a status line.
+func rebuild(ctx context.Context, name string, build func(context.Context) (builder.Result, error)) (builder.Result, error) {
+	opts := options.Get(ctx)
+	start := time.Now()
+	result, err := build(ctx)
+	stamp := start.Format("15:04:05")
+	if err != nil {
+		if ctx.Err() == nil {
+			report(err, opts.ErrorFormat)
+			fmt.Fprintf(os.Stderr, "[%s] build failed, waiting for changes\n", stamp)
+		}
+		return result, err
+	}
+	fmt.Fprintf(os.Stderr, "[%s] built %s in %v (%d diagrams rendered, %d cached)\n", stamp, name, time.Since(start).Round(time.Millisecond), result.Diagrams, result.CacheHits)
+	return result, nil
+}
+
+// wait adds the files to the watched ones and returns after some of them
+// change, even while building, and then stay unchanged for the debounce
+// duration, or when the context is done.
+func wait(ctx context.Context, w *watcher.Watcher, files []string, debounce time.Duration) error {
+	log := logging.ZapLogger(ctx).Sugar()
+	err := w.Watch(files)
+	if err != nil {
+		return err
+	}
+	var quiet <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case file := <-w.Events:
+			log.Infow("changed", "file", file)
+			quiet = time.After(debounce)
+		case <-quiet:
+			return nil
+		}
+	}
+}
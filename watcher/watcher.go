@@ -0,0 +1,73 @@
+package watcher
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// Watcher reports changes to a set of files.
+type Watcher struct {
+	// Events receives the path of every changed file.
+	Events chan string
+	mu     sync.Mutex
+	files  map[string]bool
+	// add starts watching a file, which add is called with mu held for.
+	add   func(file string) error
+	close func() error
+}
+
+// New returns a watcher of the files, which may not exist yet.
+func New(files []string) (*Watcher, error) {
+	w := &Watcher{
+		Events: make(chan string, 16),
+		files:  make(map[string]bool),
+	}
+	err := w.start()
+	if err != nil {
+		return nil, err
+	}
+	err = w.Watch(files)
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Watch adds the files, which may not exist yet, to the watched ones.
+func (w *Watcher) Watch(files []string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, f := range files {
+		a, err := filepath.Abs(f)
+		if err != nil {
+			return err
+		}
+		if w.files[a] {
+			continue
+		}
+		err = w.add(a)
+		if err != nil {
+			return err
+		}
+		w.files[a] = true
+	}
+	return nil
+}
+
+func (w *Watcher) Close() error {
+	return w.close()
+}
+
+// notify reports the change of the file if it is watched, which notify is
+// called with mu held for.
+func (w *Watcher) notify(file string) {
+	if !w.files[file] {
+		return
+	}
+	select {
+	case w.Events <- file:
+	default:
+		// a change is already pending
+	}
+}
@@ -0,0 +1,72 @@
+package watcher
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY
+
+// start watches the directories containing the files, as editors often
+// replace files instead of writing them.
+func (w *Watcher) start() error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("initializing inotify: %v", err)
+	}
+	// a non blocking file uses the runtime poller, so closing it interrupts
+	// a pending read
+	f := os.NewFile(uintptr(fd), "inotify")
+	dirs := make(map[int32]string)
+	watched := make(map[string]bool)
+	// add watches the directory of the file or, while it is missing, its
+	// nearest existing ancestor, which is watched again for it on creations
+	w.add = func(file string) error {
+		for d := filepath.Dir(file); !watched[d]; d = filepath.Dir(d) {
+			wd, err := syscall.InotifyAddWatch(fd, d, inotifyMask)
+			if err == nil {
+				dirs[int32(wd)] = d
+				watched[d] = true
+				return nil
+			}
+			if err != syscall.ENOENT || filepath.Dir(d) == d {
+				return fmt.Errorf("watching directory %q: %v", d, err)
+			}
+		}
+		return nil
+	}
+	w.close = f.Close
+	go func() {
+		buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				return
+			}
+			w.mu.Lock()
+			for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+				event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				name := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(event.Len)]
+				offset += syscall.SizeofInotifyEvent + int(event.Len)
+				if d, ok := dirs[event.Wd]; ok {
+					w.notify(filepath.Join(d, string(bytes.TrimRight(name, "\x00"))))
+				}
+				if event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+					for f := range w.files {
+						if !watched[filepath.Dir(f)] && w.add(f) == nil {
+							if _, err := os.Stat(f); err == nil {
+								w.notify(f)
+							}
+						}
+					}
+				}
+			}
+			w.mu.Unlock()
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,54 @@
+//go:build !linux
+// +build !linux
+
+package watcher
+
+import (
+	"os"
+	"time"
+)
+
+const pollInterval = 500 * time.Millisecond
+
+// start polls the modification time of the files where inotify is not
+// available.
+func (w *Watcher) start() error {
+	done := make(chan struct{})
+	w.close = func() error {
+		close(done)
+		return nil
+	}
+	modtimes := make(map[string]time.Time)
+	w.add = func(file string) error {
+		modtimes[file] = modtime(file)
+		return nil
+	}
+	go func() {
+		t := time.NewTicker(pollInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				w.mu.Lock()
+				for f := range w.files {
+					if m := modtime(f); !m.Equal(modtimes[f]) {
+						modtimes[f] = m
+						w.notify(f)
+					}
+				}
+				w.mu.Unlock()
+			}
+		}
+	}()
+	return nil
+}
+
+func modtime(file string) time.Time {
+	info, err := os.Stat(file)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}